@@ -0,0 +1,190 @@
+package randomizer
+
+import (
+	"context"
+	"fmt"
+)
+
+// Options are the settings used by Randomize. the zero value gives a normal
+// seed with no optional shuffles.
+type Options struct {
+	Treewarp bool // warp to ember tree by pressing start+B on map screen
+	Hard     bool // enable more difficult logic
+	Dungeons bool // shuffle dungeon entrances
+	Portals  bool // shuffle subrosia portal connections (seasons only)
+	Race     bool // don't reveal the seed in the ROM or option string
+
+	// item placement algorithm: "forward" (the default) or "assumed".
+	// seeds are only reproducible using the same algorithm.
+	Fill string
+
+	// where small keys, boss keys, and slates can be placed: "off" (the
+	// default) for their own dungeon, "dungeons" for any dungeon, or
+	// "anywhere".
+	Keysanity string
+
+	// where dungeon maps and compasses can be placed: "dungeon" (the default)
+	// for their own dungeon, "anywhere", or "vanilla".
+	Maps string
+
+	// number of essences needed for the maku seed, from 0 to 8. zero means
+	// all 8.
+	Essences int
+
+	// if true, no essences are needed; only the final boss.
+	BossOnly bool
+
+	// names of items that link starts the game with, as in the spoiler log.
+	// these are removed from the item pool.
+	StartingItems []string
+
+	// names of checks that can only hold inert items, as in the spoiler log.
+	Excluded []string
+
+	// names of tricks to allow in logic, from logic/tricks.yaml. Hard allows
+	// all of them.
+	Tricks []string
+
+	// contents of a yaml file of changes to the logic. see overlay.go for the
+	// format. unlike other options, this applies even with Settings.
+	LogicOverlay string
+
+	// contents of asm files to apply on top of the built-in asm, in order.
+	// see asm/README.md for the format. these also apply even with Settings.
+	Asm []string
+
+	// if true, owl statues give hints. HintMix gives the number of each type
+	// of hint in the format "woth=4,barren=3,always=3"; the remaining owls
+	// give item hints. an empty HintMix uses the default.
+	Hints   bool
+	HintMix string
+
+	// if true, the spoiler logs include a playthrough: only the checks needed
+	// to beat the seed, by sphere.
+	Playthrough bool
+
+	// contents of a yaml file of item placement rules. see rules.go for the
+	// format.
+	Rules string
+
+	// specific 32-bit hex seed to use. a seed based on the current time is
+	// used if this is empty.
+	Seed string
+
+	// contents of a plan file, in spoiler log format. if non-empty, the plan
+	// is used instead of a random seed.
+	Plan string
+
+	// a settings string, as in Result. if non-empty, it's used instead of
+	// every other option, and Plan must be empty.
+	Settings string
+}
+
+// Result is the output of Randomize. nothing in it has been written to disk.
+type Result struct {
+	ROM       []byte // randomized ROM data
+	Game      string // "seasons" or "ages"
+	Seed      uint32
+	SHA1      []byte // SHA-1 sum of ROM
+	Spoiler   []byte // text of the spoiler log, with CRLF line endings
+	JSONLog   []byte // the spoiler log as json; see spoiler_json.go
+	OptString string // seed and options, as used in output filenames
+	Settings  string // settings string; see settings.go
+	Symbols   []byte // BGB/mGBA symbol file for the ROM's custom code
+}
+
+// Randomize randomizes a copy of the given vanilla US seasons or ages ROM
+// using the given options. it doesn't touch the global RNG or command-line
+// flags, so it's safe to call from multiple goroutines, and it only reads the
+// filesystem if a data directory was set with -datadir. the search for a
+// valid seed stops early if the context is canceled.
+func Randomize(ctx context.Context, vanillaROM []byte,
+	opts Options) (*Result, error) {
+	return randomizeBytes(ctx, vanillaROM, opts, func(string, ...interface{}) {})
+}
+
+// like Randomize, but with progress messages sent to logf.
+func randomizeBytes(ctx context.Context, vanillaROM []byte, opts Options,
+	logf logFunc) (*Result, error) {
+	game, err := checkGivenRom(vanillaROM, "given ROM")
+	if err != nil {
+		return nil, err
+	}
+	b := make([]byte, len(vanillaROM))
+	copy(b, vanillaROM)
+	rom := newRomState(b, game)
+
+	ropts := randomizerOptions{
+		treewarp:    opts.Treewarp,
+		hard:        opts.Hard,
+		dungeons:    opts.Dungeons,
+		portals:     opts.Portals,
+		fill:        opts.Fill,
+		keys:        opts.Keysanity,
+		maps:        opts.Maps,
+		essences:    opts.Essences,
+		bossOnly:    opts.BossOnly,
+		starting:    opts.StartingItems,
+		excluded:    opts.Excluded,
+		tricks:      opts.Tricks,
+		hints:       opts.Hints,
+		hintMix:     opts.HintMix,
+		race:        opts.Race,
+		seed:        opts.Seed,
+		playthrough: opts.Playthrough,
+	}
+	if opts.Settings != "" {
+		if opts.Plan != "" {
+			return nil, fmt.Errorf("can't use both a settings string and a plan")
+		}
+		if ropts, err = decodeSettings(opts.Settings, game); err != nil {
+			return nil, err
+		}
+		ropts.playthrough = opts.Playthrough
+	} else if opts.Rules != "" {
+		ropts.placement, err = parsePlacementRules(opts.Rules, game)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if opts.LogicOverlay != "" {
+		ropts.overlay, err = newLogicOverlay(
+			"logic overlay", []byte(opts.LogicOverlay))
+		if err != nil {
+			return nil, err
+		}
+	}
+	for i, source := range opts.Asm {
+		pack, err := parseAsmPack(
+			fmt.Sprintf("asm file %d", i+1), []byte(source))
+		if err != nil {
+			return nil, err
+		}
+		ropts.asmPacks = append(ropts.asmPacks, pack)
+	}
+	if opts.Plan != "" {
+		if ropts.plan, err = parsePlan(opts.Plan, game); err != nil {
+			return nil, err
+		}
+	}
+	if err := ropts.validate(game); err != nil {
+		return nil, err
+	}
+
+	out, err := randomize(ctx, rom, ropts, false, logf)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Result{
+		ROM:       rom.data,
+		Game:      gameNames[game],
+		Seed:      out.seed,
+		SHA1:      out.checksum,
+		Spoiler:   out.summary,
+		JSONLog:   out.jsonLog,
+		OptString: optString(out.seed, out.ropts, "-"),
+		Settings:  out.settings,
+		Symbols:   rom.getSymbols(),
+	}, nil
+}
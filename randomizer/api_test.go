@@ -0,0 +1,14 @@
+package randomizer
+
+import (
+	"context"
+	"testing"
+)
+
+func TestRandomizeInvalidRom(t *testing.T) {
+	for _, b := range [][]byte{nil, make([]byte, 0x100000)} {
+		if _, err := Randomize(context.Background(), b, Options{}); err == nil {
+			t.Errorf("expected error for invalid %d-byte ROM", len(b))
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package randomizer
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// implements the -asm option, which applies asm files from outside the
+// randomizer on top of the built-in ones, so that mods can be distributed
+// separately. the files use the same format as the files in asm/.
+
+// reads asm files from a list of paths. directories are replaced by the yaml
+// files in them, in alphabetical order.
+func loadAsmPacks(paths []string) ([]*asmData, error) {
+	packs := make([]*asmData, 0, len(paths))
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		filenames := []string{path}
+		if info.IsDir() {
+			if filenames, err = filepath.Glob(
+				filepath.Join(path, "*.yaml")); err != nil {
+				return nil, err
+			}
+			sort.Strings(filenames)
+		}
+
+		for _, filename := range filenames {
+			b, err := ioutil.ReadFile(filename)
+			if err != nil {
+				return nil, err
+			}
+			pack, err := parseAsmPack(filename, b)
+			if err != nil {
+				return nil, err
+			}
+			packs = append(packs, pack)
+		}
+	}
+	return packs, nil
+}
+
+// parses an asm file, checking that its keys are valid metalabels and its
+// values are strings. filename is only used in errors.
+func parseAsmPack(filename string, b []byte) (*asmData, error) {
+	pack := &asmData{filename: filename}
+	if err := yaml.UnmarshalStrict(b, pack); err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+
+	for _, section := range []struct {
+		name     string
+		slice    yaml.MapSlice
+		floating bool
+	}{
+		{"common", pack.Common, false},
+		{"floating", pack.Floating, true},
+		{"seasons", pack.Seasons, false},
+		{"ages", pack.Ages, false},
+	} {
+		for _, item := range section.slice {
+			k, ok := item.Key.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s: %s: invalid key: %v",
+					filename, section.name, item.Key)
+			}
+			if _, ok := item.Value.(string); !ok {
+				return nil, fmt.Errorf("%s: %s: %s: value is not a string",
+					filename, section.name, k)
+			}
+			if n := strings.Count(k, "/"); (section.floating && n != 0) ||
+				(!section.floating && (n < 1 || n > 2)) {
+				return nil, fmt.Errorf("%s: %s: invalid metalabel: %s",
+					filename, section.name, k)
+			}
+		}
+	}
+
+	// only floating code from the same file can be included
+	floating := make(map[string]bool)
+	for _, item := range pack.Floating {
+		floating[item.Key.(string)] = true
+	}
+	for _, slice := range []yaml.MapSlice{pack.Common, pack.Seasons,
+		pack.Ages} {
+		for _, item := range slice {
+			v := item.Value.(string)
+			if strings.HasPrefix(v, "/include") {
+				if name := strings.TrimSpace(v[8:]); !floating[name] {
+					return nil, fmt.Errorf("%s: %s: no floating code named %s",
+						filename, item.Key, name)
+				}
+			}
+		}
+	}
+
+	return pack, nil
+}
+
+// applies asm files on top of the built-in asm. returns an error if a file
+// redefines an existing label, writes over other code, or doesn't fit in a
+// bank.
+func (rom *romState) applyAsmPacks(packs []*asmData) error {
+	for _, pack := range packs {
+		if err := rom.applyAsmPack(pack); err != nil {
+			return fmt.Errorf("%s: %v", pack.filename, err)
+		}
+	}
+	return nil
+}
+
+// applies a single asm file; see applyAsmPacks.
+func (rom *romState) applyAsmPack(pack *asmData) (err error) {
+	// assembler errors and bank overflows panic, since they can't happen with
+	// the built-in asm.
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+
+	before := rom.getAllMutables()
+	slices := []yaml.MapSlice{pack.Common, pack.Floating,
+		sora(rom.game, pack.Seasons, pack.Ages).(yaml.MapSlice)}
+	for _, slice := range slices {
+		for _, item := range slice {
+			_, label := parseMetalabel(item.Key.(string))
+			if label != "" && before[label] != nil {
+				return fmt.Errorf("label %s is already defined", label)
+			}
+		}
+	}
+
+	// owl text grows to fit the hints, so it has to stay at the end of its
+	// bank.
+	owlText := rom.codeMutables["owlText"]
+	rom.applyAsmData([]*asmData{pack})
+	owlText.addr.offset = rom.bankEnds[owlText.addr.bank]
+	rom.assembler.define("owlText", owlText.addr.offset)
+
+	// check new code against everything else, like TestMutableOverlap.
+	after := rom.getAllMutables()
+	for _, k := range orderedKeys(after) {
+		mut, ok := after[k].(*mutableRange)
+		if !ok || before[k] == after[k] {
+			continue
+		} else if before[k] != nil {
+			return fmt.Errorf("%s overwrites built-in code", k)
+		}
+		for _, other := range orderedKeys(after) {
+			otherMut, ok := after[other].(*mutableRange)
+			if ok && other != k && mut.overlaps(otherMut) {
+				return fmt.Errorf("%s overlaps %s at %02x:%04x",
+					k, other, mut.addr.bank, mut.addr.offset)
+			}
+		}
+	}
+
+	return nil
+}
+
+// returns true if the two ranges share any bytes.
+func (mut *mutableRange) overlaps(other *mutableRange) bool {
+	start, otherStart := mut.addr.fullOffset(), other.addr.fullOffset()
+	return start < otherStart+len(other.new) &&
+		otherStart < start+len(mut.new)
+}
+
+// returns the filenames of the asm files.
+func getAsmPackNames(packs []*asmData) []string {
+	names := make([]string, len(packs))
+	for i, pack := range packs {
+		names[i] = pack.filename
+	}
+	return names
+}
@@ -0,0 +1,70 @@
+package randomizer
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAsmPacks(t *testing.T) {
+	for source, want := range map[string]string{
+		"common: {3f: ret}":                 "invalid metalabel",
+		"floating: {3f/code: ret}":          "invalid metalabel",
+		"common: {3f/code: [ret]}":          "not a string",
+		"common: {3f/code: /include other}": "no floating code",
+		"bogus: {}":                         "field bogus not found",
+	} {
+		if _, err := parseAsmPack("bad.yaml", []byte(source)); err == nil ||
+			!strings.HasPrefix(err.Error(), "bad.yaml: ") ||
+			!strings.Contains(err.Error(), want) {
+			t.Errorf("%q: got error %v, want %q", source, err, want)
+		}
+	}
+
+	for source, want := range map[string]string{
+		"common: {02/treeWarp: ret}": "already defined",
+		"common: {02/602c/: nop}":    "overwrites built-in code",
+	} {
+		pack, err := parseAsmPack("bad.yaml", []byte(source))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = newRomState(nil, gameSeasons).applyAsmPacks([]*asmData{pack})
+		if err == nil || !strings.HasPrefix(err.Error(), "bad.yaml: ") ||
+			!strings.Contains(err.Error(), want) {
+			t.Errorf("%q: got error %v, want %q", source, err, want)
+		}
+	}
+
+	pack, err := parseAsmPack("good.yaml", []byte(`
+floating:
+  testFunc: ret
+seasons:
+  3f/testCode: /include testFunc
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rom := newRomState(nil, gameSeasons)
+	if err := rom.applyAsmPacks([]*asmData{pack}); err != nil {
+		t.Fatal(err)
+	}
+	if rom.codeMutables["testCode"] == nil {
+		t.Error("label from asm file not defined")
+	}
+	if owlText := rom.codeMutables["owlText"]; owlText.addr.offset !=
+		rom.bankEnds[owlText.addr.bank] {
+		t.Error("owl text not at end of bank")
+	}
+}
+
+func TestMutableRangeOverlaps(t *testing.T) {
+	a := &mutableRange{addr: address{0x02, 0x4000}, new: []byte{0, 0}}
+	b := &mutableRange{addr: address{0x02, 0x4001}, new: []byte{0}}
+	c := &mutableRange{addr: address{0x02, 0x4002}, new: []byte{0}}
+	if !a.overlaps(b) || !b.overlaps(a) {
+		t.Error("overlapping ranges not detected")
+	}
+	if a.overlaps(c) || c.overlaps(a) {
+		t.Error("adjacent ranges detected as overlapping")
+	}
+}
@@ -0,0 +1,221 @@
+package randomizer
+
+import (
+	"container/list"
+	"strings"
+)
+
+// names of item placement algorithms.
+const (
+	fillForward = "forward"
+	fillAssumed = "assumed"
+)
+
+var fillAlgorithms = []string{fillForward, fillAssumed}
+
+// the signature shared by item placement algorithms. returns true iff
+// successful.
+type fillFunc func(ri *routeInfo, itemList, slotList *list.List,
+	treasures map[string]*treasure, game int, verbose bool, logf logFunc) bool
+
+// returns the placement function for the named algorithm. an empty name means
+// the default (forward) algorithm.
+func getFillFunc(name string) fillFunc {
+	if name == fillAssumed {
+		return tryAssumedFill
+	}
+	return tryPlaceItems
+}
+
+// places items using assumed fill: each progression item is placed in a slot
+// that's reachable assuming that all the items not yet placed are already
+// owned, so placements can't lock the seed out of completion. keys and seeds
+// go first since they have the fewest valid slots, then other
+// progression items, then inert items in whatever slots are left.
+func tryAssumedFill(ri *routeInfo, itemList, slotList *list.List,
+	treasures map[string]*treasure, game int, verbose bool,
+	logf logFunc) bool {
+	start := ri.graph["start"]
+	reserved := getReservedSlots(itemList, slotList, ri.rules)
+
+	// the lists are already shuffled, so partitioning them stably keeps the
+	// order random within each group. maps and compasses go with the other
+	// inert items so that they don't take slots that keys need. rupees go
+	// before other progression because they're interchangeable; if they went
+	// last, a single rupee could gate everything placed behind a shop.
+	groups := make([][]*list.Element, 5)
+	for ei := itemList.Front(); ei != nil; ei = ei.Next() {
+		name := ei.Value.(*node).name
+		switch {
+		case getItemDungeon(name, ri.rules) != "" &&
+			!itemIsInert(treasures, name):
+			groups[0] = append(groups[0], ei)
+		case sliceContains(seedNames, name):
+			groups[1] = append(groups[1], ei)
+		case strings.HasPrefix(name, "rupees"):
+			groups[2] = append(groups[2], ei)
+		case !itemIsInert(treasures, name):
+			groups[3] = append(groups[3], ei)
+		default:
+			groups[4] = append(groups[4], ei)
+		}
+	}
+
+	for _, group := range groups {
+		for _, ei := range group {
+			if verbose {
+				logf("searching; filling %d more slots", slotList.Len())
+				logf("(%d more items)", itemList.Len())
+			}
+
+			item := ei.Value.(*node)
+			progression := !itemIsInert(treasures, item.name)
+			var early map[*node]bool
+			if progression {
+				early = getEarlySlots(ri.graph, itemList, slotList)
+			}
+			item.removeParent(start)
+			if progression {
+				ri.graph.reset()
+				start.explore()
+			}
+
+			// keep slots that are reachable without any of the remaining
+			// items open as long as possible, since the last items placed
+			// will need them.
+			es := findAssumedSlot(ri, item, ei, slotList, itemList,
+				reserved, treasures, game, func(slot *node) bool {
+					return !early[slot]
+				})
+			if es == nil {
+				es = findAssumedSlot(ri, item, ei, slotList, itemList,
+					reserved, treasures, game, nil)
+			}
+			if es == nil {
+				if verbose {
+					logf("search failed; no slot for %s", item.name)
+				}
+				return false
+			}
+
+			slot := es.Value.(*node)
+			if reserved[slot] != "" {
+				delete(reserved, slot)
+			}
+			item.addParent(slot)
+			ri.usedItems.PushBack(itemList.Remove(ei))
+			ri.usedSlots.PushBack(slotList.Remove(es))
+			if verbose {
+				logf("placing: %s <- %s", slot.name, item.name)
+			}
+		}
+	}
+
+	return itemList.Len() == 0
+}
+
+// returns the first slot in the list that the item can be placed in, or nil
+// if there is none. if the item is progression, the slot must be reachable
+// in the graph's current state. if filter is non-nil, the slot must also
+// satisfy it.
+func findAssumedSlot(ri *routeInfo, item *node, ei *list.Element, slotList,
+	itemList *list.List, reserved map[*node]string,
+	treasures map[string]*treasure, game int,
+	filter func(*node) bool) *list.Element {
+	progression := !itemIsInert(treasures, item.name)
+	for es := slotList.Front(); es != nil; es = es.Next() {
+		slot := es.Value.(*node)
+		if !ri.slotAccepts(item, slot, treasures) ||
+			(filter != nil && !filter(slot)) {
+			continue
+		}
+		if progression && !slot.reached {
+			continue
+		}
+		if dungeonsOverfilled(game, ei, es, itemList, slotList, ri.rules) {
+			continue
+		}
+
+		// don't use up an item that a remaining slot depends on, unless
+		// this is that slot.
+		if reserved[slot] != item.name &&
+			countList(itemList, func(e *list.Element) bool {
+				return e.Value.(*node).name == item.name
+			})-1 < countReserved(reserved, item.name) {
+			continue
+		}
+
+		return es
+	}
+	return nil
+}
+
+// returns a map of slots that only one kind of item in the pool fits in, to
+// the name of that item.
+func getReservedSlots(itemList, slotList *list.List,
+	rules dungeonItemRules) map[*node]string {
+	names := make(map[string]*node)
+	for ei := itemList.Front(); ei != nil; ei = ei.Next() {
+		item := ei.Value.(*node)
+		names[item.name] = item
+	}
+
+	reserved := make(map[*node]string)
+	for es := slotList.Front(); es != nil; es = es.Next() {
+		slot := es.Value.(*node)
+		fits := ""
+		for _, name := range orderedKeys(names) {
+			if itemFitsInSlot(names[name], slot, rules) {
+				if fits != "" {
+					fits = ""
+					break
+				}
+				fits = name
+			}
+		}
+		if fits != "" {
+			reserved[slot] = fits
+		}
+	}
+
+	return reserved
+}
+
+// returns the set of slots that are reachable without any of the items in
+// the pool.
+func getEarlySlots(g graph, itemList, slotList *list.List) map[*node]bool {
+	start := g["start"]
+	g.batch(func() {
+		for ei := itemList.Front(); ei != nil; ei = ei.Next() {
+			ei.Value.(*node).removeParent(start)
+		}
+	})
+	g.reset()
+	start.explore()
+
+	early := make(map[*node]bool)
+	for es := slotList.Front(); es != nil; es = es.Next() {
+		if slot := es.Value.(*node); slot.reached {
+			early[slot] = true
+		}
+	}
+
+	g.batch(func() {
+		for ei := itemList.Front(); ei != nil; ei = ei.Next() {
+			ei.Value.(*node).addParent(start)
+		}
+	})
+
+	return early
+}
+
+// returns the number of slots reserved for the named item.
+func countReserved(reserved map[*node]string, name string) int {
+	n := 0
+	for _, v := range reserved {
+		if v == name {
+			n++
+		}
+	}
+	return n
+}
@@ -101,9 +101,7 @@ func makeRoomTreasureTable(game int, itemSlots map[string]*itemSlot) string {
 	for _, key := range orderedKeys(itemSlots) {
 		slot := itemSlots[key]
 
-		if key != "maku path basement" &&
-			slot.collectMode != collectModes["drop"] &&
-			(game == gameAges || slot.collectMode != collectModes["d4 pool"]) {
+		if !inRoomTreasureTable(game, key, slot) {
 			continue
 		}
 
@@ -128,6 +126,62 @@ func makeRoomTreasureTable(game int, itemSlots map[string]*itemSlot) string {
 	return b.String()
 }
 
+// returns true if the slot's treasure is given by the roomTreasures table
+// instead of by its own interaction.
+func inRoomTreasureTable(game int, name string, slot *itemSlot) bool {
+	return name == "maku path basement" ||
+		slot.collectMode == collectModes["drop"] ||
+		(game == gameSeasons && slot.collectMode == collectModes["d4 pool"])
+}
+
+// returns a byte table of (group, room, dungeon index) entries for small keys
+// and boss keys that aren't in their own dungeon. the table is padded with $ff
+// to the size it would be if every slot held one, so that its size doesn't
+// depend on item placement.
+func makeKeyDungeonTable(itemSlots map[string]*itemSlot) string {
+	b := new(strings.Builder)
+	size := 1
+
+	for _, key := range orderedKeys(itemSlots) {
+		slot := itemSlots[key]
+		size += 3 * (1 + len(slot.moreRooms))
+
+		// accommodate nil treasures, like makeRoomTreasureTable.
+		if slot.treasure == nil || (slot.treasure.id != 0x30 &&
+			slot.treasure.id != 0x31) {
+			continue
+		}
+		dungeon := getDungeonName(slot.treasure.displayName)
+		if dungeon == "" ||
+			strings.HasPrefix(getDungeonName(key), dungeon) {
+			continue
+		}
+
+		index := getDungeonIndex(dungeon)
+		b.Write([]byte{slot.group, slot.room, index})
+		for _, groupRoom := range slot.moreRooms {
+			b.Write([]byte{byte(groupRoom >> 8), byte(groupRoom), index})
+		}
+	}
+
+	for b.Len() < size {
+		b.WriteByte(0xff)
+	}
+	return b.String()
+}
+
+// returns the value of wDungeonIndex for the named dungeon.
+func getDungeonIndex(name string) byte {
+	switch name {
+	case "d6 present":
+		return 0x06
+	case "d6 past":
+		return 0x0c
+	default:
+		return name[1] - '0'
+	}
+}
+
 // that's correct
 type eobThing struct {
 	addr         address
@@ -245,7 +299,7 @@ func (rom *romState) applyAsmFiles(infos []os.FileInfo) {
 
 		path := "/asm/" + info.Name()
 		if err := yaml.Unmarshal(
-			FSMustByte(false, path), asmFiles[i]); err != nil {
+			mustReadData(path), asmFiles[i]); err != nil {
 			panic(err)
 		}
 	}
@@ -290,7 +344,7 @@ func parseMetalabel(ml string) (addr address, label string) {
 func loadBankEnds(game string) []uint16 {
 	eobs := make(map[string][]uint16)
 	if err := yaml.Unmarshal(
-		FSMustByte(false, "/romdata/eob.yaml"), eobs); err != nil {
+		mustReadData("/romdata/eob.yaml"), eobs); err != nil {
 		panic(err)
 	}
 	return eobs[game]
@@ -301,7 +355,7 @@ func (rom *romState) attachText() {
 	// load initial text
 	textMap := make(map[string]map[string]string)
 	if err := yaml.Unmarshal(
-		FSMustByte(false, "/romdata/text.yaml"), textMap); err != nil {
+		mustReadData("/romdata/text.yaml"), textMap); err != nil {
 		panic(err)
 	}
 	for label, rawText := range textMap[gameNames[rom.game]] {
@@ -362,7 +416,7 @@ func loadShopNames(game string) map[string]string {
 	}
 	for _, filename := range itemFiles {
 		if err := yaml.Unmarshal(
-			FSMustByte(false, filename), m); err != nil {
+			mustReadData(filename), m); err != nil {
 			panic(err)
 		}
 	}
@@ -394,17 +448,28 @@ func (rom *romState) initBanks() {
 		makeCollectModeTable(rom.itemSlots))
 	rom.replaceRaw(address{roomTreasureBank, 0}, "roomTreasures",
 		makeRoomTreasureTable(rom.game, rom.itemSlots))
+	rom.replaceRaw(address{roomTreasureBank, 0}, "keyDungeons",
+		makeKeyDungeonTable(rom.itemSlots))
+	rom.replaceRaw(address{byte(sora(rom.game, 0x0a, 0x03).(int)), 0},
+		"startingItems", makeStartingItemTable(nil, nil))
 	rom.replaceRaw(address{0x3f, 0}, "owlTextOffsets",
 		string(make([]byte, numOwlIds*2)))
 
 	// load all asm files in the asm/ directory.
-	dir, err := FS(false).Open("/asm/")
-	if err != nil {
-		panic(err)
-	}
-	fi, err := dir.Readdir(-1)
+	fi, err := readDataDir("/asm/")
 	if err != nil {
 		panic(err)
 	}
 	rom.applyAsmFiles(fi)
 }
+
+// returns the name of the dungeon with the given wDungeonIndex value, or an
+// empty string if there is none.
+func getDungeonNameByIndex(game int, index byte) string {
+	for _, name := range dungeonNames[game] {
+		if getDungeonIndex(name) == index {
+			return name
+		}
+	}
+	return ""
+}
@@ -0,0 +1,114 @@
+package randomizer
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// implements the -datadir flag, which layers a directory over the embedded
+// asm, hints, logic, and romdata files so that changes to them can be tested
+// without regenerating and rebuilding. files in the directory replace
+// embedded files with the same path, and new asm files are added.
+
+// directories that can be overridden.
+var dataDirNames = []string{"asm", "hints", "logic", "romdata"}
+
+// the directory set by setDataDir, or empty if there is none.
+var dataDir string
+
+// sets the directory to read data files from, reloading data that's read at
+// startup. this should be called before anything else is loaded. returns the
+// paths of the embedded files that the directory overrides, like
+// "/logic/rings.yaml"; new files aren't included.
+func setDataDir(dir string) ([]string, error) {
+	if info, err := os.Stat(dir); err != nil {
+		return nil, err
+	} else if !info.IsDir() {
+		return nil, fmt.Errorf("%s: not a directory", dir)
+	}
+	dataDir = dir
+
+	paths := make([]string, 0)
+	for _, name := range dataDirNames {
+		infos, err := ioutil.ReadDir(filepath.Join(dir, name))
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		for _, info := range infos {
+			path := "/" + name + "/" + info.Name()
+			if _, err := FSByte(false, path); err == nil && !info.IsDir() {
+				paths = append(paths, path)
+			}
+		}
+	}
+
+	loadRings()
+	loadTrickDescriptions()
+	return paths, nil
+}
+
+// returns the contents of a data file, from the data directory if it has the
+// file and from the embedded files otherwise. paths are like FSByte's.
+func readData(path string) ([]byte, error) {
+	if dataDir != "" {
+		b, err := ioutil.ReadFile(filepath.Join(dataDir,
+			filepath.FromSlash(path)))
+		if err == nil || !os.IsNotExist(err) {
+			return b, err
+		}
+	}
+	return FSByte(false, path)
+}
+
+// like readData, but panics on error.
+func mustReadData(path string) []byte {
+	b, err := readData(path)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// returns the files in a data directory like "/asm/", sorted by name. files in
+// the data directory replace embedded files with the same name.
+func readDataDir(path string) ([]os.FileInfo, error) {
+	dir, err := FS(false).Open(path)
+	if err != nil {
+		return nil, err
+	}
+	infos, err := dir.Readdir(-1)
+	if err != nil {
+		return nil, err
+	}
+
+	byName := make(map[string]os.FileInfo, len(infos))
+	for _, info := range infos {
+		byName[info.Name()] = info
+	}
+	if dataDir != "" {
+		infos, err := ioutil.ReadDir(filepath.Join(dataDir,
+			filepath.FromSlash(path)))
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		for _, info := range infos {
+			if !info.IsDir() {
+				byName[info.Name()] = info
+			}
+		}
+	}
+
+	infos = make([]os.FileInfo, 0, len(byName))
+	for _, info := range byName {
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name() < infos[j].Name()
+	})
+	return infos, nil
+}
@@ -0,0 +1,63 @@
+package randomizer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDataDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "datadir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func() {
+		dataDir = ""
+		loadRings()
+		loadTrickDescriptions()
+	}()
+
+	files := map[string]string{
+		"hints/common_items.yaml": "sword: a test sword\n",
+		"asm/zz_test.yaml":        "common: []\n",
+	}
+	for name, contents := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, err = setDataDir(filepath.Join(dir, "asm", "zz_test.yaml"))
+	if err == nil {
+		t.Error("no error for non-directory")
+	}
+	paths, err := setDataDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != 1 || paths[0] != "/hints/common_items.yaml" {
+		t.Errorf("wrong overridden paths: %v", paths)
+	}
+
+	if b := mustReadData("/hints/common_items.yaml"); string(b) !=
+		files["hints/common_items.yaml"] {
+		t.Errorf("override not read: %q", b)
+	}
+	if _, err := readData("/hints/seasons_items.yaml"); err != nil {
+		t.Error("embedded file not read:", err)
+	}
+
+	infos, err := readDataDir("/asm/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) < 2 || infos[len(infos)-1].Name() != "zz_test.yaml" {
+		t.Error("new asm file not listed last")
+	}
+}
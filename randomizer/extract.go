@@ -0,0 +1,479 @@
+package randomizer
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// implements the extract subcommand: reads item placements and other
+// randomized data back out of a ROM made by this version of the randomizer,
+// and writes them in spoiler log format so that they can be given to -plan.
+//
+// some things can't be recovered. owl hints aren't extracted, and since maps
+// and compasses are the same treasure in every dungeon, the ones outside their
+// own dungeons are assigned to dungeons arbitrarily. dungeon entrances and
+// subrosia portals are only extracted if the vanilla ROM is also given, since
+// randomized warps are copies of vanilla data from other warps.
+
+// randomized data read from a ROM.
+type extraction struct {
+	game      int
+	sum       [sha1.Size]byte
+	optString string // as shown on the file select screen
+	treewarp  bool
+	essences  int
+	keys      string
+	plan      *plan
+}
+
+// reads randomized data from a ROM. vanilla can be nil, in which case dungeon
+// entrances and portals aren't read.
+func extractRom(data, vanilla []byte) (*extraction, error) {
+	if len(data) != 0x40*bankSize ||
+		(!romIsAges(data) && !romIsSeasons(data)) {
+		return nil, fmt.Errorf("not an oracles ROM")
+	}
+	if romIsVanilla(data) {
+		return nil, fmt.Errorf("ROM is not randomized")
+	}
+	game := ternary(romIsSeasons(data), gameSeasons, gameAges).(int)
+	if vanilla != nil && romIsSeasons(vanilla) != (game == gameSeasons) {
+		return nil, fmt.Errorf("vanilla ROM is for a different game")
+	}
+
+	rom := newRomState(data, game)
+	rom.setCodeSlotAddrs()
+	codeData := func(label string) []byte {
+		mut := rom.codeMutables[label]
+		offset := mut.addr.fullOffset()
+		return data[offset : offset+len(mut.new)]
+	}
+
+	// the first row of file select text has the version, and the second has
+	// the seed and options.
+	tiles, versionTiles := codeData("dma_FileSelectStringTiles"),
+		fileSelectVersionTiles()
+	if !bytes.Equal(tiles[2:2+len(versionTiles)], versionTiles) {
+		return nil, fmt.Errorf("ROM wasn't made by randomizer version %s",
+			version)
+	}
+
+	ex := &extraction{
+		game: game,
+		sum:  sha1.Sum(data),
+		optString: strings.ReplaceAll(strings.ToLower(
+			strings.TrimSpace(tilesToString(tiles[0x22:0x32]))), " ", "-"),
+		treewarp: codeData("treeWarp")[5] == 0x28,
+		essences: int(codeData("requiredEssences")[0]),
+		plan:     newPlan(),
+	}
+
+	companion := int(codeData("romAnimalRegion")[0]) - 0x0a
+	if companion < ricky || companion > moosh {
+		return nil, fmt.Errorf("invalid companion: %d", companion)
+	}
+
+	// build a reverse lookup for treasures that can be identified by id and
+	// subid alone.
+	treasureNames := make(map[uint16]string)
+	for _, name := range orderedKeys(rom.treasures) {
+		t := rom.treasures[name]
+		if getStringIndex(seedNames, name) != -1 ||
+			t.id == 0x2d || (t.id >= 0x30 && t.id <= 0x33) ||
+			(game == gameSeasons && t.id == 0x0e) {
+			continue
+		}
+		key := uint16(t.id)<<8 | uint16(t.subid)
+		if treasureNames[key] == "" {
+			treasureNames[key] = name
+		}
+	}
+	getTreasureName := func(id, subid byte) (string, error) {
+		switch {
+		case id == 0x2d:
+			// rings are identified by param, which is randomized
+			addr := getTreasureAddr(data, game, id, subid)
+			if param := int(data[addr.fullOffset()+1]); param < len(rings) {
+				return rings[param], nil
+			}
+		case id == 0x0e && game == gameSeasons:
+			// seasons flutes are all the same treasure
+			return []string{"", "ricky's flute", "dimitri's flute",
+				"moosh's flute"}[companion], nil
+		default:
+			name := treasureNames[uint16(id)<<8|uint16(subid)]
+			if name != "" {
+				return name, nil
+			}
+		}
+		return "", fmt.Errorf("unknown treasure: %02x%02x", id, subid)
+	}
+
+	// keys outside their own dungeon are listed in the keyDungeons table.
+	keyDungeons := make(map[uint16]string)
+	table := codeData("keyDungeons")
+	for i := 0; i+2 < len(table) && table[i] != 0xff; i += 3 {
+		keyDungeons[uint16(table[i])<<8|uint16(table[i+1])] =
+			getDungeonNameByIndex(game, table[i+2])
+	}
+
+	// item slots
+	g := newRouteGraph(rom, nil)
+	roomTreasures := codeData("roomTreasures")
+	nRoomTreasures := 0
+	mapSlots := make(map[string]byte)
+	for _, name := range orderedKeys(rom.itemSlots) {
+		slot := rom.itemSlots[name]
+
+		var id, subid byte
+		switch {
+		case seedTreeNames[name]:
+			// seed types are easiest to get from the trees' map icons
+			label := inflictCamelCase(name) + "MapIcon"
+			if rom.codeMutables[label] == nil {
+				label += "1"
+			}
+			seedType := int(codeData(label)[0]) - 0x15
+			if seedType < 0 || seedType >= len(seedNames) {
+				return nil, fmt.Errorf("invalid seed type for %s", name)
+			}
+			ex.plan.items[name] = seedNames[seedType]
+			continue
+		case inRoomTreasureTable(game, name, slot):
+			i := nRoomTreasures * 4
+			id, subid = roomTreasures[i+2], roomTreasures[i+3]
+			nRoomTreasures++
+		case len(slot.idAddrs) > 0 && slot.idAddrs[0].offset != 0:
+			id = data[slot.idAddrs[0].fullOffset()]
+			if len(slot.subidAddrs) > 0 {
+				subid = data[slot.subidAddrs[0].fullOffset()]
+			}
+		default:
+			continue // not randomized
+		}
+
+		if g[name] == nil {
+			continue
+		}
+
+		switch id {
+		case 0x30, 0x31: // small key, boss key
+			dungeon := keyDungeons[uint16(slot.group)<<8|uint16(slot.room)]
+			if dungeon == "" {
+				dungeon = getDungeonName(name)
+			}
+			item := dungeon + " small key"
+			if id == 0x31 && len(dungeon) >= 2 {
+				item = dungeon[:2] + " boss key"
+			}
+			if rom.treasures[item] == nil {
+				return nil, fmt.Errorf("invalid key in %s", name)
+			}
+			ex.plan.items[name] = item
+		case 0x32, 0x33: // compass, dungeon map
+			mapSlots[name] = id
+		default:
+			item, err := getTreasureName(id, subid)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", name, err)
+			}
+			ex.plan.items[name] = item
+		}
+	}
+
+	if err := ex.assignMaps(rom, mapSlots); err != nil {
+		return nil, err
+	}
+	ex.keys = getExtractedKeysanity(ex.plan.items)
+
+	// starting items
+	table = codeData("startingItems")
+	for i := 0; i+1 < len(table) && table[i] != 0xff; i += 2 {
+		if table[i] == 0x2d {
+			// starting rings are given by param instead of subid
+			if int(table[i+1]) >= len(rings) {
+				return nil, fmt.Errorf("invalid starting ring")
+			}
+			ex.plan.starting = append(ex.plan.starting, rings[table[i+1]])
+		} else {
+			item, err := getTreasureName(table[i], table[i+1])
+			if err != nil {
+				return nil, fmt.Errorf("starting items: %v", err)
+			}
+			ex.plan.starting = append(ex.plan.starting, item)
+		}
+	}
+
+	// default seasons
+	if game == gameSeasons {
+		for _, area := range seasonAreas {
+			id := int(codeData(inflictCamelCase(area + "Season"))[0])
+			if id >= len(seasonsById) {
+				return nil, fmt.Errorf("invalid season for %s", area)
+			}
+			ex.plan.seasons[area] = seasonsById[id]
+		}
+	}
+
+	if vanilla != nil {
+		if err := ex.extractWarps(data, vanilla); err != nil {
+			return nil, err
+		}
+	}
+
+	return ex, nil
+}
+
+// fills in the plan's maps and compasses, given a map of the slots that
+// contain them to treasure IDs. items are put in their own dungeons when
+// possible, and the rest are assigned to the remaining dungeons in order.
+func (ex *extraction) assignMaps(rom *romState, slots map[string]byte) error {
+	used := make(map[string]bool)
+	pending := make([]string, 0)
+	for _, name := range orderedKeys(slots) {
+		item := getDungeonName(name) + getMapSuffix(slots[name])
+		if rom.treasures[item] != nil && !used[item] {
+			ex.plan.items[name] = item
+			used[item] = true
+		} else {
+			pending = append(pending, name)
+		}
+	}
+
+	for _, name := range pending {
+		for _, dungeon := range dungeonNames[ex.game] {
+			item := dungeon + getMapSuffix(slots[name])
+			if rom.treasures[item] != nil && !used[item] {
+				ex.plan.items[name] = item
+				used[item] = true
+				break
+			}
+		}
+		if ex.plan.items[name] == "" {
+			return fmt.Errorf("too many maps and compasses")
+		}
+	}
+
+	return nil
+}
+
+// returns the suffix of compass or dungeon map names for a treasure ID.
+func getMapSuffix(id byte) string {
+	return ternary(id == 0x32, " compass", " dungeon map").(string)
+}
+
+// returns the keysanity level implied by key placement, or "" if keys are all
+// in their own dungeons.
+func getExtractedKeysanity(items map[string]string) string {
+	keys := ""
+	for slot, item := range items {
+		if !strings.HasSuffix(item, "small key") &&
+			!strings.HasSuffix(item, "boss key") {
+			continue
+		}
+		if getDungeonName(slot) == "" {
+			return keysAnywhere
+		} else if !strings.HasPrefix(getDungeonName(slot), getDungeonName(item)) {
+			keys = keysAnyDungeon
+		}
+	}
+	return keys
+}
+
+// reads dungeon entrances and subrosia portals by matching randomized warp
+// data against vanilla data. warps are only included if they're shuffled.
+func (ex *extraction) extractWarps(data, vanilla []byte) error {
+	warps := (&romState{game: ex.game, data: vanilla}).loadWarps()
+
+	// randomized entries are copies of their destinations' vanilla entries
+	getDest := func(src string, candidates []string) (string, error) {
+		warp := warps[src]
+		entry := data[warp.entryOffset : warp.entryOffset+warp.len]
+		for _, dest := range candidates {
+			if bytes.Equal(entry, warps[dest].vanillaEntryData) {
+				return dest, nil
+			}
+		}
+		return "", fmt.Errorf("unknown warp data for %s", src)
+	}
+
+	dungeons := make([]string, 0, len(dungeonNames[ex.game]))
+	for _, name := range dungeonNames[ex.game] {
+		if name != "d0" {
+			dungeons = append(dungeons, name)
+		}
+	}
+	entrances, shuffled := make(map[string]string), false
+	for _, src := range dungeons {
+		dest, err := getDest(src, dungeons)
+		if err != nil {
+			return err
+		}
+		entrances[src+" entrance"] = dest
+		shuffled = shuffled || dest != src
+	}
+	if shuffled {
+		ex.plan.dungeons = entrances
+	}
+
+	if ex.game == gameSeasons {
+		portals := make([]string, 0, len(subrosianPortalNames))
+		for _, name := range orderedKeys(subrosianPortalNames) {
+			portals = append(portals, name+" portal")
+		}
+		connects, shuffled := make(map[string]string), false
+		for _, src := range portals {
+			dest, err := getDest(src, portals)
+			if err != nil {
+				return err
+			}
+			holodrum := strings.TrimSuffix(src, " portal")
+			connects[holodrum] =
+				subrosianPortalNames[strings.TrimSuffix(dest, " portal")]
+			shuffled = shuffled || dest != src
+		}
+		if shuffled {
+			ex.plan.portals = connects
+		}
+	}
+
+	return nil
+}
+
+// writes extracted data in spoiler log format.
+func writeExtraction(w io.Writer, ex *extraction) {
+	summary, summaryDone := getSummaryChannel(w)
+	game, p := ex.game, ex.plan
+
+	// header
+	summary <- fmt.Sprintf("extracted from ROM with sha-1 sum: %x", ex.sum)
+	if ex.optString != "" {
+		summary <- fmt.Sprintf("file select text: %s", ex.optString)
+	}
+	summary <- fmt.Sprintf("tree warp: %s",
+		ternary(ex.treewarp, "on", "off"))
+	if ex.essences == 0 {
+		summary <- "goal: final boss only"
+	} else if ex.essences < 8 {
+		summary <- fmt.Sprintf("essences required: %d", ex.essences)
+	}
+	if ex.keys != "" {
+		summary <- fmt.Sprintf("keysanity: %s", ex.keys)
+	}
+
+	if len(p.starting) > 0 {
+		sendSectionHeader(summary, "starting items")
+		for _, name := range p.starting {
+			summary <- getNiceName(name, game)
+		}
+	}
+
+	sendSectionHeader(summary, "items")
+	sendSorted(summary, func(c chan string) {
+		for slot, item := range p.items {
+			c <- fmt.Sprintf("%-28s <- %s",
+				getNiceName(slot, game), getNiceName(item, game))
+		}
+		close(c)
+	})
+
+	if len(p.dungeons) > 0 {
+		sendSectionHeader(summary, "dungeon entrances")
+		sendSorted(summary, func(c chan string) {
+			for entrance, dungeon := range p.dungeons {
+				c <- fmt.Sprintf("%s <- %s",
+					getNiceName(entrance, game), getNiceName(dungeon, game))
+			}
+			close(c)
+		})
+	}
+	if len(p.portals) > 0 {
+		sendSectionHeader(summary, "subrosia portals")
+		sendSorted(summary, func(c chan string) {
+			for in, out := range p.portals {
+				c <- fmt.Sprintf("%-20s <- %s",
+					getNiceName(in, game), getNiceName(out, game))
+			}
+			close(c)
+		})
+	}
+	if len(p.seasons) > 0 {
+		sendSectionHeader(summary, "default seasons")
+		sendSorted(summary, func(c chan string) {
+			for area, season := range p.seasons {
+				c <- fmt.Sprintf("%-15s <- %s", area, season)
+			}
+			close(c)
+		})
+	}
+
+	close(summary)
+	<-summaryDone
+}
+
+// returns the string shown by file select screen tiles, the inverse of
+// stringToTiles. blank tiles are skipped.
+func tilesToString(tiles []byte) string {
+	b := new(strings.Builder)
+	for _, tile := range tiles {
+		switch {
+		case tile >= '0'-0x20 && tile <= '9'-0x20:
+			b.WriteByte(tile + 0x20)
+		case tile >= 'A'+0xa1 && tile <= 'Z'+0xa1:
+			b.WriteByte(tile - 0xa1)
+		case tile == '\xfc':
+			b.WriteByte(' ')
+		case tile == '\xfd':
+			b.WriteByte('+')
+		case tile == '\xfe':
+			b.WriteByte('-')
+		case tile == '\xff':
+			b.WriteByte('.')
+		}
+	}
+	return b.String()
+}
+
+// implements the extract subcommand. vanillaPath and outPath can be empty.
+func extractRomFile(romPath, vanillaPath, outPath string,
+	logf logFunc) error {
+	data, err := ioutil.ReadFile(romPath)
+	if err != nil {
+		return err
+	}
+	var vanilla []byte
+	if vanillaPath != "" {
+		if vanilla, _, err = readGivenRom(vanillaPath); err != nil {
+			return err
+		}
+	}
+
+	ex, err := extractRom(data, vanilla)
+	if err != nil {
+		return fmt.Errorf("%s: %v", romPath, err)
+	}
+	if vanilla == nil {
+		logf("no vanilla ROM given; not extracting dungeon entrances or " +
+			"portals")
+	}
+
+	if outPath == "" {
+		outPath = strings.TrimSuffix(romPath, filepath.Ext(romPath)) +
+			"_plan.txt"
+	}
+	f, err := os.Create(outPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	writeExtraction(f, ex)
+	logf("wrote plan to %s", outPath)
+
+	return nil
+}
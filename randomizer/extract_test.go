@@ -0,0 +1,48 @@
+package randomizer
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestExtraction(t *testing.T) {
+	if s := tilesToString(stringToTiles("RACE 123+TDO")); s != "RACE 123+TDO" {
+		t.Errorf("tiles round trip gave %q", s)
+	}
+
+	ex := &extraction{game: gameSeasons, essences: 8, plan: newPlan()}
+	p := ex.plan
+	p.items["d1 stalfos drop"] = "d3 small key"
+	p.items["d2 moblin chest"] = "d2 boss key"
+	p.items["horon village tree"] = "gale tree seeds"
+	p.items["maku tree"] = "moosh's flute"
+	p.dungeons["d1 entrance"] = "d6"
+	p.dungeons["d6 entrance"] = "d1"
+	p.portals["spool swamp"] = "great furnace"
+	p.seasons["north horon"] = "summer"
+	p.starting = []string{"feather", "power ring L-1"}
+
+	if ex.keys = getExtractedKeysanity(p.items); ex.keys != keysAnyDungeon {
+		t.Errorf("expected keysanity %q, got %q", keysAnyDungeon, ex.keys)
+	}
+
+	b := new(bytes.Buffer)
+	writeExtraction(b, ex)
+	parsed, err := parsePlan(b.String(), gameSeasons)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, pair := range map[string][2]interface{}{
+		"items":    {p.items, parsed.items},
+		"dungeons": {p.dungeons, parsed.dungeons},
+		"portals":  {p.portals, parsed.portals},
+		"seasons":  {p.seasons, parsed.seasons},
+		"starting": {p.starting, parsed.starting},
+	} {
+		if !reflect.DeepEqual(pair[0], pair[1]) {
+			t.Errorf("%s changed in round trip: %v -> %v",
+				name, pair[0], pair[1])
+		}
+	}
+}
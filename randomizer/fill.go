@@ -2,9 +2,11 @@ package randomizer
 
 import (
 	"container/list"
+	"context"
 	"fmt"
 	"math/rand"
 	"reflect"
+	"regexp"
 	"sort"
 	"strings"
 )
@@ -79,6 +81,11 @@ type routeInfo struct {
 	ringMap      map[string]string
 	attemptCount int
 	src          *rand.Rand
+	rules        dungeonItemRules
+	starting     []string
+	excluded     map[string]bool // slots that can only hold inert items
+	placement    placementRules
+	tricks       []string // enabled, not necessarily required
 }
 
 const (
@@ -87,19 +94,35 @@ const (
 	moosh   = 3
 )
 
-func newRouteGraph(rom *romState) graph {
+// returns a graph of the logic for the rom's game, with the overlay applied if
+// it's non-nil.
+func newRouteGraph(rom *romState, overlay *logicOverlay) graph {
 	g := newGraph()
-	totalPrenodes := getPrenodes(rom.game)
+	totalPrenodes := getPrenodes(rom.game, overlay)
 	addDefaultItemNodes(rom, totalPrenodes)
 	addNodes(totalPrenodes, g)
 	addNodeParents(totalPrenodes, g)
 	return g
 }
 
+// sets the number of essences needed for the maku seed in the graph. this
+// must be done before the graph is tracked.
+func setRequiredEssences(g graph, n int) {
+	req := g["required essences"]
+	if n == 0 {
+		// a count node with no minimum never gets explored
+		req.removeParent(g["essences"])
+		req.ntype = orNode
+		req.addParent(g["start"])
+	} else {
+		req.minCount = n
+	}
+}
+
 // attempts to create a path to the given targets by placing different items in
-// slots.
-func findRoute(rom *romState, seed uint32, ropts randomizerOptions,
-	verbose bool, logf logFunc) (*routeInfo, error) {
+// slots. it gives up early if the context is canceled.
+func findRoute(ctx context.Context, rom *romState, seed uint32,
+	ropts randomizerOptions, verbose bool, logf logFunc) (*routeInfo, error) {
 	// make stacks out of the item names and slot names for backtracking
 	var itemList, slotList *list.List
 
@@ -110,19 +133,38 @@ func findRoute(rom *romState, seed uint32, ropts randomizerOptions,
 		usedItems: list.New(),
 		usedSlots: list.New(),
 		src:       rand.New(rand.NewSource(int64(seed))),
+		rules:     ropts.dungeonItemRules(),
+		starting:  ropts.starting,
+		excluded:  make(map[string]bool),
+		placement: ropts.placement,
+		tricks:    ropts.enabledTricks(rom.game),
+	}
+	for _, name := range ropts.excluded {
+		ri.excluded[name] = true
+	}
+	if err := checkExcludedSlots(ri, rom); err != nil {
+		return nil, err
+	}
+	if err := checkPlacementRules(ri, rom); err != nil {
+		return nil, err
 	}
 
 	// try to find the route, retrying if needed
+	placeItems := getFillFunc(ropts.fill)
 	tries := 0
 	for tries = 0; tries < maxTries; tries++ {
-		ri.graph = newRouteGraph(rom)
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		ri.graph = newRouteGraph(rom, ropts.overlay)
+		setRequiredEssences(ri.graph, ropts.requiredEssences())
+		ri.graph.track()
 		ri.slots = make(map[string]*node, 0)
 		for name := range rom.itemSlots {
 			ri.slots[name] = ri.graph[name]
 		}
-		if ropts.hard {
-			ri.graph["hard"].addParent(ri.graph["start"])
-		}
+		linkTricks(ri.graph, ri.tricks)
 
 		ri.companion = rollAnimalCompanion(ri.src, ri.graph, rom.game)
 		ri.ringMap, _ = rom.randomizeRingPool(ri.src, nil)
@@ -133,6 +175,11 @@ func findRoute(rom *romState, seed uint32, ropts randomizerOptions,
 			item := ei.Value.(*node)
 			ri.graph[item.name].addParent(ri.graph["start"])
 		}
+		linkStartingItems(ri.graph, ri.starting)
+
+		if ropts.maps == mapsVanilla {
+			placeVanillaItems(ri, rom, itemList, slotList, mapRegexp)
+		}
 
 		// slot "world" nodes before items
 		if rom.game == gameSeasons {
@@ -142,7 +189,7 @@ func findRoute(rom *romState, seed uint32, ropts randomizerOptions,
 		ri.entrances = setDungeonEntrances(
 			ri.src, ri.graph, rom.game, ropts.dungeons)
 
-		if tryPlaceItems(
+		if placeItems(
 			ri, itemList, slotList, rom.treasures, rom.game, verbose, logf) {
 			ri.graph.reset()
 			ri.graph["start"].explore()
@@ -160,6 +207,10 @@ func findRoute(rom *romState, seed uint32, ropts randomizerOptions,
 	}
 
 	if tries >= maxTries {
+		if len(ri.placement) > 0 {
+			return nil, fmt.Errorf("could not find route after %d tries; "+
+				"placement rules may conflict with logic", maxTries)
+		}
 		return nil, fmt.Errorf("could not find route after %d tries", maxTries)
 	}
 
@@ -252,7 +303,12 @@ func setPortals(src *rand.Rand, g graph, shuffle bool) map[string]string {
 // randomly determines animal companion and returns its ID (1 to 3)
 func rollAnimalCompanion(src *rand.Rand, g graph, game int) int {
 	companion := src.Intn(3) + 1
+	linkAnimalCompanion(g, game, companion)
+	return companion
+}
 
+// links the region nodes for the given animal companion ID to start.
+func linkAnimalCompanion(g graph, game, companion int) {
 	if game == gameSeasons {
 		switch companion {
 		case ricky:
@@ -272,8 +328,43 @@ func rollAnimalCompanion(src *rand.Rand, g graph, game int) int {
 			g["moosh nuun"].addParent(g["start"])
 		}
 	}
+}
 
-	return companion
+// returns the names of the nodes that the functions above and linkTricks link
+// to or from, which logic overlays can't remove.
+func getCodeLinkedNodes(game int) map[string]bool {
+	names := map[string]bool{
+		"start":                    true,
+		"done":                     true,
+		"essences":                 true,
+		"required essences":        true,
+		"natzu prairie":            true,
+		"natzu river":              true,
+		"natzu wasteland":          true,
+		"ricky nuun":               true,
+		"dimitri nuun":             true,
+		"moosh nuun":               true,
+		"d2 alt entrances enabled": true,
+	}
+	for _, name := range getTricks(game) {
+		names[name] = true
+	}
+	for _, dungeon := range dungeonNames[game] {
+		names[dungeon+" entrance"] = true
+		names["enter "+dungeon] = true
+	}
+	for holodrum, subrosia := range subrosianPortalNames {
+		for _, portal := range []string{holodrum, subrosia} {
+			names["enter "+portal+" portal"] = true
+			names["exit "+portal+" portal"] = true
+		}
+	}
+	for _, area := range seasonAreas {
+		for _, season := range seasonsById {
+			names[fmt.Sprintf("%s default %s", area, season)] = true
+		}
+	}
+	return names
 }
 
 var seedNames = []string{"ember tree seeds", "scent tree seeds",
@@ -349,6 +440,8 @@ func initRouteInfo(
 		slotNames = append(slotNames, key)
 	}
 
+	removeStartingItems(itemNames, ri.starting)
+
 	// sort the slices so that order isn't dependent on map implementation,
 	// then shuffle the sorted slices
 	sort.Strings(itemNames)
@@ -373,6 +466,32 @@ func initRouteInfo(
 	return itemList, slotList
 }
 
+// places the items whose names match the regexp in their vanilla slots, and
+// removes them from the lists.
+func placeVanillaItems(ri *routeInfo, rom *romState,
+	itemList, slotList *list.List, re *regexp.Regexp) {
+	for es := slotList.Front(); es != nil; {
+		next := es.Next()
+		slot := es.Value.(*node)
+		t := rom.itemSlots[slot.name].treasure
+		if t == nil || !re.MatchString(t.displayName) {
+			es = next
+			continue
+		}
+
+		for ei := itemList.Front(); ei != nil; ei = ei.Next() {
+			if item := ei.Value.(*node); item.name == t.displayName {
+				item.removeParent(ri.graph["start"])
+				item.addParent(slot)
+				ri.usedItems.PushBack(itemList.Remove(ei))
+				ri.usedSlots.PushBack(slotList.Remove(es))
+				break
+			}
+		}
+		es = next
+	}
+}
+
 // returns true iff successful
 func tryPlaceItems(ri *routeInfo, itemList, slotList *list.List,
 	treasures map[string]*treasure, game int, verbose bool, logf logFunc) bool {
@@ -383,7 +502,7 @@ func tryPlaceItems(ri *routeInfo, itemList, slotList *list.List,
 		}
 
 		eItem, eSlot := trySlotRandomItem(
-			ri.graph, ri.src, itemList, slotList, treasures, game)
+			ri, itemList, slotList, treasures, game)
 
 		if eItem != nil {
 			item := itemList.Remove(eItem).(*node)
@@ -410,8 +529,11 @@ func tryPlaceItems(ri *routeInfo, itemList, slotList *list.List,
 	return true
 }
 
-func trySlotRandomItem(g graph, src *rand.Rand, itemPool, slotPool *list.List,
-	treasures map[string]*treasure, game int) (usedItem, usedSlot *list.Element) {
+func trySlotRandomItem(ri *routeInfo, itemPool, slotPool *list.List,
+	treasures map[string]*treasure,
+	game int) (usedItem, usedSlot *list.Element) {
+	g := ri.graph
+
 	// try placing the first item in a slot until it fits
 	triedProgression := false
 	for _, progressionItemsOnly := range []bool{true, false} {
@@ -431,12 +553,13 @@ func trySlotRandomItem(g graph, src *rand.Rand, itemPool, slotPool *list.List,
 			for es := slotPool.Front(); es != nil; es = es.Next() {
 				slot := es.Value.(*node)
 
-				if !itemFitsInSlot(item, slot) {
+				if !ri.slotAccepts(item, slot, treasures) {
 					continue
 				}
 
 				// make sure enough space is left for remaining dungeon items
-				if dungeonsOverfilled(game, ei, es, itemPool, slotPool) {
+				if dungeonsOverfilled(
+					game, ei, es, itemPool, slotPool, ri.rules) {
 					continue
 				}
 
@@ -465,10 +588,72 @@ func trySlotRandomItem(g graph, src *rand.Rand, itemPool, slotPool *list.List,
 	return nil, nil
 }
 
+// keysanity levels, which determine where small keys, boss keys, and slates
+// can be placed.
+const (
+	keysOwnDungeon = "off"      // only in their own dungeon
+	keysAnyDungeon = "dungeons" // in any dungeon
+	keysAnywhere   = "anywhere" // anywhere in the world
+)
+
+var keysanityLevels = []string{keysOwnDungeon, keysAnyDungeon, keysAnywhere}
+
+// map and compass shuffle levels.
+const (
+	mapsOwnDungeon = "dungeon"  // anywhere in their own dungeon
+	mapsAnywhere   = "anywhere" // anywhere in the world
+	mapsVanilla    = "vanilla"  // in their vanilla slots
+)
+
+var mapsLevels = []string{mapsOwnDungeon, mapsAnywhere, mapsVanilla}
+
+// rules for where dungeon-specific items can be placed.
+type dungeonItemRules struct {
+	keys string // keysanity level
+	maps string // map and compass shuffle level
+}
+
+// returns true iff the item can be placed in the slot, according to the
+// dungeon item rules, the excluded slots, and the placement rules.
+func (ri *routeInfo) slotAccepts(
+	item, slot *node, treasures map[string]*treasure) bool {
+	inert := itemIsInert(treasures, item.name)
+	if ri.excluded[slot.name] && !inert {
+		return false
+	}
+	if !ri.placement.allow(item.name, slot.name, inert) {
+		return false
+	}
+	return itemFitsInSlot(item, slot, ri.rules)
+}
+
+// returns the dungeon that an item must be placed in under the given rules:
+// the item's own dungeon, "any" for any dungeon, or an empty string if the
+// item can go anywhere.
+func getItemDungeon(name string, rules dungeonItemRules) string {
+	dungeonName := getDungeonName(name)
+	switch {
+	case dungeonName == "":
+		return ""
+	case keyRegexp.MatchString(name):
+		switch rules.keys {
+		case keysAnyDungeon:
+			return "any"
+		case keysAnywhere:
+			return ""
+		}
+	case mapRegexp.MatchString(name):
+		if rules.maps == mapsAnywhere {
+			return ""
+		}
+	}
+	return dungeonName
+}
+
 // checks whether the item fits in the slot due to things like seeds only going
 // in trees, certain item slots not accomodating sub IDs. this doesn't check
 // for softlocks or the availability of the slot and item.
-func itemFitsInSlot(itemNode, slotNode *node) bool {
+func itemFitsInSlot(itemNode, slotNode *node, rules dungeonItemRules) bool {
 	// dummy shop slots 1 and 2 can only hold their vanilla items.
 	switch {
 	case slotNode.name == "shop, 20 rupees" && itemNode.name != "bombs, 10":
@@ -490,12 +675,20 @@ func itemFitsInSlot(itemNode, slotNode *node) bool {
 		}
 	}
 
-	// dungeons can only hold their respective dungeon-specific items. the
-	// HasPrefix is specifically for ages d6 boss key.
-	dungeonName := getDungeonName(itemNode.name)
-	if dungeonName != "" &&
-		!strings.HasPrefix(getDungeonName(slotNode.name), dungeonName) {
-		return false
+	// dungeons can only hold their respective dungeon-specific items, unless
+	// the rules say otherwise. the HasPrefix is specifically for ages d6
+	// boss key.
+	switch dungeonName := getItemDungeon(itemNode.name, rules); dungeonName {
+	case "":
+		break
+	case "any":
+		if getDungeonName(slotNode.name) == "" {
+			return false
+		}
+	default:
+		if !strings.HasPrefix(getDungeonName(slotNode.name), dungeonName) {
+			return false
+		}
 	}
 
 	// and only seeds can be slotted in seed trees, of course
@@ -537,11 +730,13 @@ func isDeadEnd(g graph, curItem, curSlot *list.Element,
 		return false
 	}
 
-	for ei := itemPool.Front(); ei != nil; ei = ei.Next() {
-		if ei != curItem {
-			ei.Value.(*node).removeParent(g["start"])
+	g.batch(func() {
+		for ei := itemPool.Front(); ei != nil; ei = ei.Next() {
+			if ei != curItem {
+				ei.Value.(*node).removeParent(g["start"])
+			}
 		}
-	}
+	})
 	g.reset()
 	g["start"].explore()
 
@@ -553,32 +748,130 @@ func isDeadEnd(g graph, curItem, curSlot *list.Element,
 		}
 	}
 
-	for ei := itemPool.Front(); ei != nil; ei = ei.Next() {
-		if ei != curItem {
-			ei.Value.(*node).addParent(g["start"])
+	g.batch(func() {
+		for ei := itemPool.Front(); ei != nil; ei = ei.Next() {
+			if ei != curItem {
+				ei.Value.(*node).addParent(g["start"])
+			}
 		}
-	}
+	})
 
 	return dead
 }
 
 // returns true iff there are more items specific to any dungeon than there are
-// slots remaining in that dungeon. elements item and slot are not counted.
+// slots remaining in that dungeon, or more items that have to go in dungeons
+// than there are dungeon slots. elements item and slot are not counted.
 func dungeonsOverfilled(game int, item, slot *list.Element,
-	itemPool, slotPool *list.List) bool {
+	itemPool, slotPool *list.List, rules dungeonItemRules) bool {
+	// ages d6 boss key isn't correctly accounted for here. oh well.
+	nItems := make(map[string]int, len(dungeonNames[game])+1)
+	for e := itemPool.Front(); e != nil; e = e.Next() {
+		if e != item {
+			nItems[getItemDungeon(e.Value.(*node).name, rules)]++
+		}
+	}
+	nSlots := make(map[string]int, len(dungeonNames[game]))
+	for e := slotPool.Front(); e != nil; e = e.Next() {
+		if e != slot {
+			nSlots[getDungeonName(e.Value.(*node).name)]++
+		}
+	}
+
+	// items that can go in any dungeon need whatever slots are left over.
+	totalItems, totalSlots := nItems["any"], 0
 	for _, name := range dungeonNames[game] {
-		// ages d6 boss key isn't correctly accounted for here. oh well.
-		nItems := countList(itemPool, func(e *list.Element) bool {
-			return e != item && getDungeonName(e.Value.(*node).name) == name
-		})
-		nSlots := countList(slotPool, func(e *list.Element) bool {
-			return e != slot && getDungeonName(e.Value.(*node).name) == name
-		})
-		if nItems > nSlots {
+		if nItems[name] > nSlots[name] {
 			return true
 		}
+		totalItems += nItems[name]
+		totalSlots += nSlots[name]
 	}
-	return false
+	return totalItems > totalSlots
+}
+
+// returns the number of each item in the item pool, by the names of the
+// vanilla treasures. starting items are replaced by their filler.
+func getVanillaPool(rom *romState, starting []string) map[string]int {
+	pool := make(map[string]int)
+	for _, slot := range rom.itemSlots {
+		name, _ := reverseLookup(rom.treasures, slot.treasure)
+		pool[name.(string)]++
+	}
+	for _, name := range starting {
+		if pool[name] > 0 && name != "bombs, 10" && name != "wooden shield" {
+			pool[name]--
+			pool[startingItemFiller]++
+		}
+	}
+	return pool
+}
+
+// returns an error if the excluded slots leave too few slots for the items
+// that can't go in them: each dungeon's own keys, keys that can go in any
+// dungeon, and progression items in general. rings are left out, since the
+// ring pool is random.
+func checkExcludedSlots(ri *routeInfo, rom *romState) error {
+	if len(ri.excluded) == 0 {
+		return nil
+	}
+
+	// count items by where they have to go, with "" for anywhere
+	need := make(map[string]int)
+	for name, n := range getVanillaPool(rom, ri.starting) {
+		if itemIsInert(rom.treasures, name) ||
+			getStringIndex(rings, name) != -1 {
+			continue
+		}
+		need[""] += n
+		if dungeon := getItemDungeon(name, ri.rules); dungeon != "" {
+			need[dungeon] += n
+		}
+	}
+
+	// returns the non-excluded and excluded slots in the dungeon, or
+	// anywhere.
+	getSlots := func(dungeon string) (n int, excluded []string) {
+		for name := range rom.itemSlots {
+			slotDungeon := getDungeonName(name)
+			if dungeon == "any" && slotDungeon == "" ||
+				dungeon != "any" && !strings.HasPrefix(slotDungeon, dungeon) {
+				continue
+			}
+			if ri.excluded[name] {
+				excluded = append(excluded, getNiceName(name, rom.game))
+			} else {
+				n++
+			}
+		}
+		sort.Strings(excluded)
+		return n, excluded
+	}
+
+	for _, dungeon := range orderedKeys(need) {
+		n, excluded := getSlots(dungeon)
+		if dungeon == "any" {
+			// keys locked to their own dungeons also take dungeon slots
+			for name, count := range need {
+				if name != "" && name != "any" {
+					need[dungeon] += count
+				}
+			}
+		}
+		if n >= need[dungeon] {
+			continue
+		}
+
+		what := fmt.Sprintf("%d dungeon items need to go in %s", need[dungeon],
+			ternary(dungeon == "any", "dungeons", dungeon))
+		if dungeon == "" {
+			what = fmt.Sprintf("%d progression items need checks", need[dungeon])
+		}
+		return fmt.Errorf("%s, but only %d are left after excluding %s",
+			what, n, strings.Join(excluded, "; "))
+	}
+
+	return nil
 }
 
 // returns the number of elements in the list for which the given function
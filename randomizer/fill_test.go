@@ -2,6 +2,9 @@ package randomizer
 
 import (
 	"container/list"
+	"context"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -13,7 +16,7 @@ func TestGraph(t *testing.T) {
 // check that graph logic is working as expected
 func testSeasonsGraph(t *testing.T) {
 	rom := newRomState(nil, gameSeasons)
-	g := newRouteGraph(rom)
+	g := newRouteGraph(rom, nil)
 
 	// test basic start item
 	checkReach(t, g, map[string]string{
@@ -72,7 +75,7 @@ func testSeasonsGraph(t *testing.T) {
 // check that graph logic is working as expected
 func testAgesGraph(t *testing.T) {
 	rom := newRomState(nil, gameAges)
-	g := newRouteGraph(rom)
+	g := newRouteGraph(rom, nil)
 
 	// test basic start item
 	checkReach(t, g, map[string]string{
@@ -177,21 +180,279 @@ func checkReach(t *testing.T, g graph, links map[string]string, target string,
 func TestDungeonsOverfilled(t *testing.T) {
 	game := gameSeasons
 	items, slots := list.New(), list.New()
-	if dungeonsOverfilled(game, nil, nil, items, slots) {
+	if dungeonsOverfilled(game, nil, nil, items, slots, dungeonItemRules{}) {
 		t.Fatal("list is not overfilled")
 	}
 	item := items.PushBack(newNode("d1 item 1", 0))
-	if !dungeonsOverfilled(game, nil, nil, items, slots) {
+	if !dungeonsOverfilled(game, nil, nil, items, slots, dungeonItemRules{}) {
 		t.Fatal("list is overfilled")
 	}
 	slot := slots.PushBack(newNode("d1 slot 1", 0))
-	if dungeonsOverfilled(game, nil, nil, items, slots) {
+	if dungeonsOverfilled(game, nil, nil, items, slots, dungeonItemRules{}) {
 		t.Fatal("list is not overfilled")
 	}
-	if dungeonsOverfilled(game, item, nil, items, slots) {
+	if dungeonsOverfilled(game, item, nil, items, slots, dungeonItemRules{}) {
 		t.Fatal("list is not overfilled")
 	}
-	if !dungeonsOverfilled(game, nil, slot, items, slots) {
+	if !dungeonsOverfilled(game, nil, slot, items, slots, dungeonItemRules{}) {
 		t.Fatal("list is overfilled")
 	}
+
+	// keys can use other dungeons' slots, but not slots outside dungeons
+	anyDungeon := dungeonItemRules{keys: keysAnyDungeon}
+	anywhere := dungeonItemRules{keys: keysAnywhere}
+	items, slots = list.New(), list.New()
+	items.PushBack(newNode("d1 small key", 0))
+	slots.PushBack(newNode("d2 slot 1", 0))
+	if !dungeonsOverfilled(game, nil, nil, items, slots, dungeonItemRules{}) {
+		t.Fatal("list is overfilled")
+	}
+	if dungeonsOverfilled(game, nil, nil, items, slots, anyDungeon) {
+		t.Fatal("list is not overfilled")
+	}
+	items.PushBack(newNode("d2 item 1", 0))
+	slots.PushBack(newNode("horon village slot", 0))
+	if !dungeonsOverfilled(game, nil, nil, items, slots, anyDungeon) {
+		t.Fatal("list is overfilled")
+	}
+	if dungeonsOverfilled(game, nil, nil, items, slots, anywhere) {
+		t.Fatal("list is not overfilled")
+	}
+}
+
+func TestKeysanity(t *testing.T) {
+	key, bossKey := newNode("d1 small key", 0), newNode("d1 boss key", 0)
+	compass := newNode("d1 compass", 0)
+	ownSlot := newNode("d1 stalfos drop", 0)
+	otherSlot := newNode("d2 bracelet chest", 0)
+	worldSlot := newNode("maku tree", 0)
+
+	for _, tc := range []struct {
+		item, slot *node
+		keys       string
+		expect     bool
+	}{
+		{key, ownSlot, keysOwnDungeon, true},
+		{key, otherSlot, keysOwnDungeon, false},
+		{key, otherSlot, keysAnyDungeon, true},
+		{bossKey, worldSlot, keysAnyDungeon, false},
+		{bossKey, worldSlot, keysAnywhere, true},
+		{compass, otherSlot, keysAnywhere, false},
+	} {
+		rules := dungeonItemRules{keys: tc.keys}
+		if itemFitsInSlot(tc.item, tc.slot, rules) != tc.expect {
+			t.Errorf("%s in %s with keysanity %s: expected %v",
+				tc.item.name, tc.slot.name, tc.keys, tc.expect)
+		}
+	}
+
+	// seeds must still be completable when keys are away from home
+	logf := func(string, ...interface{}) {}
+	for _, keys := range []string{keysAnyDungeon, keysAnywhere} {
+		for _, game := range []int{gameSeasons, gameAges} {
+			rom := newRomState(nil, game)
+			ropts := randomizerOptions{keys: keys}
+			if _, err := findRoute(context.Background(), rom, 0x1234, ropts,
+				false, logf); err != nil {
+				t.Errorf("%s, keysanity %s: %v", gameNames[game], keys, err)
+			}
+		}
+	}
+}
+
+func TestMapShuffle(t *testing.T) {
+	compass, slot := newNode("d1 compass", 0), newNode("maku tree", 0)
+	if itemFitsInSlot(compass, slot, dungeonItemRules{}) {
+		t.Error("compass fits outside its dungeon")
+	}
+	if !itemFitsInSlot(compass, slot, dungeonItemRules{maps: mapsAnywhere}) {
+		t.Error("compass doesn't fit outside its dungeon")
+	}
+
+	logf := func(string, ...interface{}) {}
+	for _, game := range []int{gameSeasons, gameAges} {
+		rom := newRomState(nil, game)
+		ropts := randomizerOptions{maps: mapsVanilla}
+		ri, err := findRoute(
+			context.Background(), rom, 0x1234, ropts, false, logf)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for slot, item := range getChecks(ri.usedItems, ri.usedSlots) {
+			vanilla := rom.itemSlots[slot.name].treasure.displayName
+			if mapRegexp.MatchString(vanilla) && item.name != vanilla {
+				t.Errorf("%s: %s holds %s, not %s",
+					gameNames[game], slot.name, item.name, vanilla)
+			}
+		}
+	}
+}
+
+func TestAssumedFill(t *testing.T) {
+	ropts := randomizerOptions{fill: fillAssumed}
+	logf := func(string, ...interface{}) {}
+
+	for _, game := range []int{gameSeasons, gameAges} {
+		var prev map[string]string
+		for i := 0; i < 2; i++ {
+			rom := newRomState(nil, game)
+			ri, err := findRoute(
+				context.Background(), rom, 0x1234, ropts, false, logf)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// seeds must be reproducible
+			placements := make(map[string]string)
+			for slot, item := range getChecks(ri.usedItems, ri.usedSlots) {
+				placements[slot.name] = item.name
+			}
+			if len(placements) != len(rom.itemSlots) {
+				t.Errorf("%s: %d of %d slots filled", gameNames[game],
+					len(placements), len(rom.itemSlots))
+			}
+			if prev != nil && !reflect.DeepEqual(prev, placements) {
+				t.Errorf("%s: placements differ for same seed",
+					gameNames[game])
+			}
+			prev = placements
+		}
+	}
+}
+
+func TestStartingItems(t *testing.T) {
+	if err := validateStartingItems([]string{"not an item"},
+		gameSeasons); err == nil {
+		t.Error("invalid starting item accepted")
+	}
+
+	logf := func(string, ...interface{}) {}
+	for _, game := range []int{gameSeasons, gameAges} {
+		rom := newRomState(nil, game)
+		starting := []string{"feather", "flippers", "power ring L-1"}
+		if err := validateStartingItems(starting, game); err != nil {
+			t.Fatal(err)
+		}
+
+		vanilla := 0
+		for _, slot := range rom.itemSlots {
+			if slot.treasure == rom.treasures["flippers"] {
+				vanilla++
+			}
+		}
+
+		ropts := randomizerOptions{starting: starting}
+		ri, err := findRoute(
+			context.Background(), rom, 0x1234, ropts, false, logf)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		placed := 0
+		for _, item := range getChecks(ri.usedItems, ri.usedSlots) {
+			if item.name == "flippers" {
+				placed++
+			}
+		}
+		if placed != vanilla-1 {
+			t.Errorf("%s: %d flippers placed, expected %d",
+				gameNames[game], placed, vanilla-1)
+		}
+		if !ri.graph["flippers"].reached {
+			t.Errorf("%s: starting flippers not reached", gameNames[game])
+		}
+	}
+}
+
+func TestRequiredEssences(t *testing.T) {
+	for _, game := range []int{gameSeasons, gameAges} {
+		g := newRouteGraph(newRomState(nil, game), nil)
+		setRequiredEssences(g, 0)
+		checkReach(t, g, map[string]string{}, "required essences", true)
+
+		g = newRouteGraph(newRomState(nil, game), nil)
+		setRequiredEssences(g, 1)
+		checkReach(t, g, map[string]string{}, "required essences", false)
+	}
+
+	logf := func(string, ...interface{}) {}
+	for _, ropts := range []randomizerOptions{
+		{essences: 3},
+		{bossOnly: true},
+	} {
+		for _, game := range []int{gameSeasons, gameAges} {
+			rom := newRomState(nil, game)
+			if _, err := findRoute(context.Background(), rom, 0x1234, ropts,
+				false, logf); err != nil {
+				t.Errorf("%s, %d essences: %v", gameNames[game],
+					ropts.requiredEssences(), err)
+			}
+		}
+	}
+}
+
+func TestExcludedSlots(t *testing.T) {
+	excluded := [][]string{
+		gameSeasons: {"blaino prize", "subrosian dance hall",
+			"member's shop 1", "shop, 150 rupees"},
+		gameAges: {"goron dance present", "big bang game",
+			"goron shooting gallery", "wild tokay game"},
+	}
+
+	logf := func(string, ...interface{}) {}
+	for _, fill := range fillAlgorithms {
+		for _, game := range []int{gameSeasons, gameAges} {
+			rom := newRomState(nil, game)
+			ropts := randomizerOptions{fill: fill, excluded: excluded[game]}
+			ri, err := findRoute(
+				context.Background(), rom, 0x1234, ropts, false, logf)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for slot, item := range getChecks(ri.usedItems, ri.usedSlots) {
+				if ri.excluded[slot.name] &&
+					!itemIsInert(rom.treasures, item.name) {
+					t.Errorf("%s, %s fill: %s holds %s", gameNames[game],
+						fill, slot.name, item.name)
+				}
+			}
+		}
+	}
+}
+
+func TestCheckExcludedSlots(t *testing.T) {
+	rom := newRomState(nil, gameSeasons)
+	d1, all := make(map[string]bool), make(map[string]bool)
+	for name := range rom.itemSlots {
+		if getDungeonName(name) == "d1" {
+			d1[name] = true
+		}
+		all[name] = true
+	}
+
+	for _, tc := range []struct {
+		keys     string
+		excluded map[string]bool
+		want     string // empty for no error
+	}{
+		{keysOwnDungeon, d1, "need to go in d1"},
+		{keysAnyDungeon, d1, ""},
+		{keysAnywhere, d1, ""},
+		{keysAnywhere, all, "progression items need checks"},
+	} {
+		ri := &routeInfo{
+			rules:    dungeonItemRules{keys: tc.keys},
+			excluded: tc.excluded,
+		}
+		err := checkExcludedSlots(ri, rom)
+		if tc.want == "" && err != nil {
+			t.Errorf("keys %s: %v", tc.keys, err)
+		} else if tc.want != "" && (err == nil ||
+			!strings.Contains(err.Error(), tc.want) ||
+			!strings.Contains(err.Error(), "D1 stalfos drop")) {
+			t.Errorf("keys %s: got error %v, want %q", tc.keys, err, tc.want)
+		}
+	}
 }
@@ -32,8 +32,11 @@ func (g graph) addParents(links map[string][]string) {
 
 // resets all the nodes in a graph to an unreached state (unless it's true
 // without any reached parents). this is required any time relationships in the
-// graph change.
+// graph change, unless the graph is tracked.
 func (g graph) reset() {
+	if g.reachState() != nil {
+		return
+	}
 	for _, n := range g {
 		n.indegree = 0
 		n.reached = n.indegree >= n.mindegree()
@@ -61,6 +64,10 @@ type node struct {
 	parents  []*node
 	children []*node
 	nChecked uint64
+
+	// set if the node's graph is tracked
+	id int
+	rs *reachState
 }
 
 // returns a new unconnected graph node, not yet part of any graph.
@@ -96,6 +103,9 @@ func (n *node) mindegree() int {
 func (n *node) addParent(parent *node) {
 	n.parents = append(n.parents, parent)
 	parent.children = append(parent.children, n)
+	if n.rs != nil {
+		n.rs.addLink(n.id, n.rs.idOf(parent))
+	}
 }
 
 // removes the given node from this node's parents, once. it panics if the
@@ -110,6 +120,9 @@ func (n *node) removeParent(parent *node) {
 				}
 			}
 			n.parents = append(n.parents[:i], n.parents[i+1:]...)
+			if n.rs != nil {
+				n.rs.removeLink(n.id, n.rs.idOf(parent))
+			}
 			return
 		}
 	}
@@ -118,6 +131,13 @@ func (n *node) removeParent(parent *node) {
 
 // removes all parent connections from the node.
 func (n *node) clearParents() {
+	if n.rs != nil {
+		for len(n.parents) > 0 {
+			n.removeParent(n.parents[0])
+		}
+		return
+	}
+
 	for _, p := range n.parents {
 		for i, c := range p.children {
 			if c == n {
@@ -133,8 +153,12 @@ func (n *node) clearParents() {
 func (n *node) String() string { return n.name }
 
 // explores the graph starting from the given node, assuming the given node is
-// reachable, marking successors as appropriate.
+// reachable, marking successors as appropriate. nodes in tracked graphs are
+// always up to date, so this does nothing for them.
 func (n *node) explore() {
+	if n.rs != nil {
+		return
+	}
 	n.reached = true
 
 	// rupees node sets indegree of children to total # of rupees reached
@@ -0,0 +1,326 @@
+package randomizer
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// implements the graph devcmd, which writes the logic graph in graphviz DOT
+// or GraphML format for viewing in other programs.
+
+// dot shapes for each node type.
+var dotShapes = map[nodeType]string{
+	andNode:    "box",
+	orNode:     "ellipse",
+	countNode:  "diamond",
+	rupeesNode: "hexagon",
+}
+
+// names for each node type, used in GraphML.
+var nodeTypeNames = map[nodeType]string{
+	andNode:    "and",
+	orNode:     "or",
+	countNode:  "count",
+	rupeesNode: "rupees",
+}
+
+// a view of a graph, possibly limited to a subset of nodes and annotated with
+// the placements from a seed.
+type graphExport struct {
+	nodes    []*node
+	included map[*node]bool
+	tricky   map[*node]bool  // nodes that can't be reached without tricks
+	checks   map[*node]*node // slot -> item, if there's a seed
+	spheres  map[*node]int   // slot -> sphere, or -1 if inaccessible
+}
+
+// returns an export of the graph. if root is non-empty, only the root and its
+// ancestors are included. if ri is non-nil, its placements are included; g
+// should be ri's graph in that case.
+func newGraphExport(
+	g graph, root string, ri *routeInfo) (*graphExport, error) {
+	ge := &graphExport{
+		included: make(map[*node]bool),
+		tricky:   getTrickOnlyNodes(g),
+		spheres:  make(map[*node]int),
+	}
+
+	if root == "" {
+		for _, n := range g {
+			ge.included[n] = true
+		}
+	} else {
+		if g[root] == nil {
+			return nil, fmt.Errorf("no such node: %s", root)
+		}
+		queue := []*node{g[root]}
+		ge.included[g[root]] = true
+		for len(queue) > 0 {
+			for _, parent := range queue[0].parents {
+				if !ge.included[parent] {
+					ge.included[parent] = true
+					queue = append(queue, parent)
+				}
+			}
+			queue = queue[1:]
+		}
+	}
+
+	for n := range ge.included {
+		ge.nodes = append(ge.nodes, n)
+	}
+	sort.Slice(ge.nodes, func(i, j int) bool {
+		return ge.nodes[i].name < ge.nodes[j].name
+	})
+
+	if ri != nil {
+		ge.checks = getChecks(ri.usedItems, ri.usedSlots)
+		spheres, extra := getSpheres(g, ge.checks)
+		for i, sphere := range spheres {
+			for _, n := range sphere {
+				ge.spheres[n] = i
+			}
+		}
+		for _, n := range extra {
+			ge.spheres[n] = -1
+		}
+	}
+
+	return ge, nil
+}
+
+// returns the set of nodes that can only be reached through trick nodes,
+// regardless of what else is reachable.
+func getTrickOnlyNodes(g graph) map[*node]bool {
+	tricky := make(map[*node]bool)
+	for _, descriptions := range trickDescriptions {
+		for name := range descriptions {
+			if n := g[name]; n != nil {
+				tricky[n] = true
+			}
+		}
+	}
+
+	// iterate until nothing changes. this can only add nodes, so it ends.
+	for changed := true; changed; {
+		changed = false
+		for _, n := range g {
+			if tricky[n] || len(n.parents) == 0 {
+				continue
+			}
+			numTricky := 0
+			for _, parent := range n.parents {
+				if tricky[parent] {
+					numTricky++
+				}
+			}
+			if (n.ntype == orNode && numTricky == len(n.parents)) ||
+				(n.ntype != orNode && numTricky > 0) {
+				tricky[n] = true
+				changed = true
+			}
+		}
+	}
+
+	return tricky
+}
+
+// returns the text label for a node.
+func (ge *graphExport) label(n *node) string {
+	label := n.name
+	if n.ntype == countNode {
+		label += fmt.Sprintf("\n(%d)", n.minCount)
+	}
+	if sphere, ok := ge.spheres[n]; ok && ge.checks[n] != nil {
+		if sphere == -1 {
+			label += "\n(inaccessible)"
+		} else {
+			label += fmt.Sprintf("\n(sphere %d)", sphere)
+		}
+	}
+	return label
+}
+
+// returns true if the parent -> child edge is an item placement.
+func (ge *graphExport) isPlacement(parent, child *node) bool {
+	return ge.checks != nil && ge.checks[parent] == child
+}
+
+// writes the graph in graphviz DOT format. trick-only edges are dashed and red,
+// and item placements are bold and blue.
+func (ge *graphExport) writeDOT(w io.Writer) error {
+	b := new(strings.Builder)
+	b.WriteString("digraph logic {\n")
+	for _, n := range ge.nodes {
+		fmt.Fprintf(b, "\t%s [shape=%s, label=%s];\n", strconv.Quote(n.name),
+			dotShapes[n.ntype], strconv.Quote(ge.label(n)))
+	}
+	for _, child := range ge.nodes {
+		for _, parent := range child.parents {
+			if !ge.included[parent] {
+				continue
+			}
+			attrs := make([]string, 0, 2)
+			if ge.tricky[parent] {
+				attrs = append(attrs, "style=dashed, color=red")
+			}
+			if ge.isPlacement(parent, child) {
+				attrs = append(attrs, "style=bold, color=blue")
+			}
+			fmt.Fprintf(b, "\t%s -> %s", strconv.Quote(parent.name),
+				strconv.Quote(child.name))
+			if len(attrs) > 0 {
+				fmt.Fprintf(b, " [%s]", strings.Join(attrs, ", "))
+			}
+			b.WriteString(";\n")
+		}
+	}
+	b.WriteString("}\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// types for GraphML encoding.
+type (
+	graphMLDoc struct {
+		XMLName xml.Name     `xml:"graphml"`
+		Xmlns   string       `xml:"xmlns,attr"`
+		Keys    []graphMLKey `xml:"key"`
+		Graph   graphMLGraph `xml:"graph"`
+	}
+	graphMLKey struct {
+		ID       string `xml:"id,attr"`
+		For      string `xml:"for,attr"`
+		AttrName string `xml:"attr.name,attr"`
+		AttrType string `xml:"attr.type,attr"`
+	}
+	graphMLGraph struct {
+		ID          string        `xml:"id,attr"`
+		EdgeDefault string        `xml:"edgedefault,attr"`
+		Nodes       []graphMLNode `xml:"node"`
+		Edges       []graphMLEdge `xml:"edge"`
+	}
+	graphMLNode struct {
+		ID   string        `xml:"id,attr"`
+		Data []graphMLData `xml:"data"`
+	}
+	graphMLEdge struct {
+		Source string        `xml:"source,attr"`
+		Target string        `xml:"target,attr"`
+		Data   []graphMLData `xml:"data"`
+	}
+	graphMLData struct {
+		Key   string `xml:"key,attr"`
+		Value string `xml:",chardata"`
+	}
+)
+
+// writes the graph in GraphML format. node type, count minimum, and sphere
+// are node attributes; trick-only edges and placements are edge attributes.
+func (ge *graphExport) writeGraphML(w io.Writer) error {
+	doc := graphMLDoc{
+		Xmlns: "http://graphml.graphdrawing.org/xmlns",
+		Keys: []graphMLKey{
+			{"type", "node", "type", "string"},
+			{"min", "node", "min", "int"},
+			{"sphere", "node", "sphere", "int"},
+			{"trick", "edge", "trick", "boolean"},
+			{"placement", "edge", "placement", "boolean"},
+		},
+		Graph: graphMLGraph{ID: "logic", EdgeDefault: "directed"},
+	}
+
+	for _, n := range ge.nodes {
+		gn := graphMLNode{ID: n.name, Data: []graphMLData{
+			{"type", nodeTypeNames[n.ntype]},
+		}}
+		if n.ntype == countNode {
+			gn.Data = append(gn.Data,
+				graphMLData{"min", strconv.Itoa(n.minCount)})
+		}
+		if sphere, ok := ge.spheres[n]; ok && ge.checks[n] != nil {
+			gn.Data = append(gn.Data,
+				graphMLData{"sphere", strconv.Itoa(sphere)})
+		}
+		doc.Graph.Nodes = append(doc.Graph.Nodes, gn)
+	}
+	for _, child := range ge.nodes {
+		for _, parent := range child.parents {
+			if !ge.included[parent] {
+				continue
+			}
+			doc.Graph.Edges = append(doc.Graph.Edges, graphMLEdge{
+				Source: parent.name,
+				Target: child.name,
+				Data: []graphMLData{
+					{"trick", strconv.FormatBool(ge.tricky[parent])},
+					{"placement", strconv.FormatBool(
+						ge.isPlacement(parent, child))},
+				},
+			})
+		}
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// writes the graph for a game to a file, or stdout if the path is empty. the
+// format is GraphML if the file extension is .graphml, and DOT otherwise. if
+// ropts has a seed, placements for that seed are included.
+func exportGraph(game int, root, path string, ropts randomizerOptions) error {
+	rom := newRomState(nil, game)
+	var g graph
+	var ri *routeInfo
+	if ropts.seed == "" {
+		g = newRouteGraph(rom, ropts.overlay)
+	} else {
+		seed, err := parseSeed(ropts.seed)
+		if err != nil {
+			return err
+		}
+		if err := ropts.ungetNiceNames(rom); err != nil {
+			return err
+		}
+		ri, err = findRoute(context.Background(), rom, seed, ropts, false,
+			func(string, ...interface{}) {})
+		if err != nil {
+			return err
+		}
+		g = ri.graph
+	}
+
+	ge, err := newGraphExport(g, root, ri)
+	if err != nil {
+		return err
+	}
+
+	w := io.Writer(os.Stdout)
+	if path != "" {
+		f, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	if strings.HasSuffix(path, ".graphml") {
+		return ge.writeGraphML(w)
+	}
+	return ge.writeDOT(w)
+}
@@ -0,0 +1,114 @@
+package randomizer
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGraphExport(t *testing.T) {
+	g := newGraph()
+	for _, n := range []*node{newNode("start", andNode),
+		newNode("hard", andNode), newNode("easy", andNode),
+		newNode("either", orNode), newNode("trick", andNode),
+		newNode("unrelated", andNode)} {
+		g[n.name] = n
+	}
+	g.addParents(map[string][]string{
+		"hard":      {"start"},
+		"easy":      {"start"},
+		"trick":     {"hard", "easy"},
+		"either":    {"easy", "trick"},
+		"unrelated": {"start"},
+	})
+
+	ge, err := newGraphExport(g, "either", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ge.tricky[g["trick"]] || ge.tricky[g["either"]] ||
+		ge.tricky[g["easy"]] {
+		t.Errorf("wrong trick-only nodes: %v", ge.tricky)
+	}
+	if ge.included[g["unrelated"]] || len(ge.nodes) != 5 {
+		t.Errorf("wrong nodes for ancestors of either: %v", ge.nodes)
+	}
+
+	b := new(bytes.Buffer)
+	if err := ge.writeDOT(b); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{
+		`"either" [shape=ellipse, label="either"];`,
+		`"trick" -> "either" [style=dashed, color=red];`,
+		`"easy" -> "either";`,
+	} {
+		if !strings.Contains(b.String(), s) {
+			t.Errorf("DOT output missing %q:\n%s", s, b.String())
+		}
+	}
+
+	if _, err := newGraphExport(g, "nonexistent", nil); err == nil {
+		t.Error("expected error for nonexistent root")
+	}
+
+	// with a seed, placements should be in the output
+	rom := newRomState(nil, gameSeasons)
+	ri, err := findRoute(context.Background(), rom, 0x1234,
+		randomizerOptions{}, false, func(string, ...interface{}) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ge, err = newGraphExport(ri.graph, "done", ri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Reset()
+	if err := ge.writeGraphML(b); err != nil {
+		t.Fatal(err)
+	}
+	var doc graphMLDoc
+	if err := xml.Unmarshal(b.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	placements := 0
+	for _, e := range doc.Graph.Edges {
+		for _, d := range e.Data {
+			if d.Key == "placement" && d.Value == "true" {
+				placements++
+			}
+		}
+	}
+	if placements == 0 {
+		t.Error("no placements in GraphML output")
+	}
+}
+
+func TestExportGraphOptions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "graph")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "seed.dot")
+
+	// nice names should work the same as when randomizing
+	if err := exportGraph(gameSeasons, "done", path, randomizerOptions{
+		seed:     "1234",
+		excluded: []string{"D1 stalfos drop"},
+	}); err != nil {
+		t.Error(err)
+	}
+
+	if err := exportGraph(gameSeasons, "done", path, randomizerOptions{
+		seed:     "1234",
+		excluded: []string{"nonexistent check"},
+	}); err == nil {
+		t.Error("expected error for nonexistent excluded check")
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"math/rand"
 	"sort"
+	"strconv"
 	"strings"
 
 	"gopkg.in/yaml.v2"
@@ -13,7 +14,7 @@ import (
 func getOwlIds(game int) map[string]byte {
 	owls := make(map[string]map[string]byte)
 	if err := yaml.Unmarshal(
-		FSMustByte(false, "/romdata/owls.yaml"), owls); err != nil {
+		mustReadData("/romdata/owls.yaml"), owls); err != nil {
 		panic(err)
 	}
 	return owls[gameNames[game]]
@@ -42,9 +43,11 @@ func (rom *romState) setOwlData(owlHints map[string]string) {
 
 	rom.codeMutables["owlTextOffsets"] = table
 	rom.codeMutables["owlText"] = text
+	rom.codeMutables["owlHintsEnabled"].new[0] = 1
 }
 
 type hinter struct {
+	game  int
 	areas map[string]string
 	items map[string]string
 }
@@ -52,6 +55,7 @@ type hinter struct {
 // returns a new hinter initialized for the given game.
 func newHinter(game int) *hinter {
 	h := &hinter{
+		game:  game,
 		areas: make(map[string]string),
 		items: make(map[string]string),
 	}
@@ -63,7 +67,7 @@ func newHinter(game int) *hinter {
 	}
 	for _, filename := range itemFiles {
 		if err := yaml.Unmarshal(
-			FSMustByte(false, filename), h.items); err != nil {
+			mustReadData(filename), h.items); err != nil {
 			panic(err)
 		}
 	}
@@ -72,7 +76,7 @@ func newHinter(game int) *hinter {
 	rawAreas := make(map[string][]string)
 	areasFilename := fmt.Sprintf("/hints/%s_areas.yaml", gameNames[game])
 	if err := yaml.Unmarshal(
-		FSMustByte(false, areasFilename), rawAreas); err != nil {
+		mustReadData(areasFilename), rawAreas); err != nil {
 		panic(err)
 	}
 
@@ -87,36 +91,101 @@ func newHinter(game int) *hinter {
 	return h
 }
 
-// returns a randomly generated map of owl names to owl messages.
+// types of owl hints.
+const (
+	hintWoth   = "woth"   // an area on the way of the hero
+	hintBarren = "barren" // an area with nothing required
+	hintAlways = "always" // a check in alwaysHintedChecks
+	hintItem   = "item"   // a random check; fills the remaining owls
+)
+
+// checks whose contents are always worth a hint, since they take a long time.
+var alwaysHintedChecks = map[int][]string{
+	gameSeasons: {"blaino prize", "subrosian dance hall",
+		"master diver's reward", "subrosia market, 5th item",
+		"tower of autumn", "great furnace"},
+	gameAges: {"goron dance present", "big bang game", "wild tokay game",
+		"goron shooting gallery", "target carts 2", "cheval's test"},
+}
+
+const defaultHintMix = "woth=4,barren=3,always=3"
+
+// the number of each type of hint to give, other than item hints.
+type hintMix map[string]int
+
+// parses a hint mix in the format "type=count,type=count".
+func parseHintMix(s string) (hintMix, error) {
+	mix := make(hintMix)
+	for _, pair := range strings.Split(s, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		kv := strings.Split(pair, "=")
+		n, err := 0, error(nil)
+		if len(kv) == 2 {
+			n, err = strconv.Atoi(kv[1])
+		}
+		if len(kv) != 2 || err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid hint count: %q", pair)
+		}
+		switch kv[0] {
+		case hintWoth, hintBarren, hintAlways:
+			mix[kv[0]] = n
+		default:
+			return nil, fmt.Errorf("unknown hint type: %q", kv[0])
+		}
+	}
+	return mix, nil
+}
+
+// returns a randomly generated map of owl names to owl messages. typed hints
+// are given according to the mix, and any remaining owls get item hints.
 func (h *hinter) generate(src *rand.Rand, g graph, checks map[*node]*node,
-	owlNames []string) map[string]string {
-	// function body starts here lol
+	owlNames []string, mix hintMix,
+	treasures map[string]*treasure) map[string]string {
 	hints := make(map[string]string)
-	slots := getShuffledHintSlots(src, checks)
-	i := 0
 
 	// keep track of which slots have been hinted at in order to avoid
-	// duplicates. in practice the implementation of the hint loop makes this
-	// very unlikely in the first place.
+	// duplicates.
 	hintedSlots := make(map[*node]bool)
 
-	for _, owlName := range owlNames {
+	// typed hints go to owls in random order.
+	owls := make([]string, len(owlNames))
+	copy(owls, owlNames)
+	sort.Strings(owls)
+	src.Shuffle(len(owls), func(i, j int) {
+		owls[i], owls[j] = owls[j], owls[i]
+	})
+	for _, hint := range h.typedHints(src, g, checks, mix, treasures,
+		hintedSlots) {
+		if len(owls) == 0 {
+			break
+		}
+		hints[owls[0]] = h.format(hint)
+		owls = owls[1:]
+	}
+	sort.Strings(owls)
+
+	slots := getShuffledHintSlots(src, checks)
+	given := make(map[string]bool) // different slots can give the same text
+	i := 0
+
+	for _, owlName := range owls {
 		// sometimes owls are just unreachable, so anything goes, i guess
 		g.reset()
 		g["start"].explore()
 		owlUnreachable := !g[owlName].reached
 
-		// if we're in plando mode, there could be no slots.
-		if len(slots) == 0 || len(hintedSlots) >= len(slots) {
-			hints[owlName] = h.format("...")
-			continue
-		}
-
-		for {
+		// if we're in plando mode, there could be no slots, and there might
+		// not be any suitable slots left in any case.
+		hints[owlName] = h.format("...")
+		for n := 0; n < len(slots); n++ {
 			slot, item := slots[i], checks[slots[i]]
 			i = (i + 1) % len(slots)
 
-			if hintedSlots[slot] {
+			text := fmt.Sprintf("%s holds %s.",
+				h.areas[slot.name], h.items[item.name])
+			if hintedSlots[slot] || given[text] {
 				continue
 			}
 
@@ -129,9 +198,8 @@ func (h *hinter) generate(src *rand.Rand, g graph, checks map[*node]*node,
 			item.addParent(slot)
 
 			if !required || owlUnreachable {
-				hints[owlName] = h.format(fmt.Sprintf("%s holds %s.",
-					h.areas[slot.name], h.items[item.name]))
-				hintedSlots[slot] = true
+				hints[owlName] = h.format(text)
+				hintedSlots[slot], given[text] = true, true
 				break
 			}
 		}
@@ -140,6 +208,85 @@ func (h *hinter) generate(src *rand.Rand, g graph, checks map[*node]*node,
 	return hints
 }
 
+// returns unformatted hint messages according to the mix, in the order
+// always, woth, barren. slots hinted by always hints are added to hintedSlots.
+func (h *hinter) typedHints(src *rand.Rand, g graph, checks map[*node]*node,
+	mix hintMix, treasures map[string]*treasure,
+	hintedSlots map[*node]bool) []string {
+	hints := make([]string, 0)
+
+	// always-hinted checks
+	slotsByName := make(map[string]*node)
+	for slot := range checks {
+		slotsByName[slot.name] = slot
+	}
+	always := make([]*node, 0)
+	for _, name := range alwaysHintedChecks[h.game] {
+		if slot := slotsByName[name]; slot != nil {
+			always = append(always, slot)
+		}
+	}
+	src.Shuffle(len(always), func(i, j int) {
+		always[i], always[j] = always[j], always[i]
+	})
+	for _, slot := range always {
+		if len(hints) >= mix[hintAlways] {
+			break
+		}
+		hints = append(hints, fmt.Sprintf("%s holds %s.",
+			capitalize(getNiceName(slot.name, h.game)),
+			h.items[checks[slot].name]))
+		hintedSlots[slot] = true
+	}
+
+	// areas are on the way of the hero if they hold a required item that
+	// isn't a dungeon item, and barren if they hold no required items at all.
+	prog, _ := filterJunk(g, checks, treasures)
+	woth, required := make(map[string]bool), make(map[string]bool)
+	for slot, item := range prog {
+		required[h.areas[slot.name]] = true
+		if getDungeonName(item.name) == "" {
+			woth[h.areas[slot.name]] = true
+		}
+	}
+	barren := make(map[string]bool)
+	for slot := range checks {
+		if area := h.areas[slot.name]; !required[area] {
+			barren[area] = true
+		}
+	}
+
+	for _, hint := range []struct {
+		areas  map[string]bool
+		n      int
+		format string
+	}{
+		{woth, mix[hintWoth], "%s is on the way of the hero."},
+		{barren, mix[hintBarren], "%s is barren."},
+	} {
+		areas := orderedKeys(hint.areas)
+		src.Shuffle(len(areas), func(i, j int) {
+			areas[i], areas[j] = areas[j], areas[i]
+		})
+		if len(areas) > hint.n {
+			areas = areas[:hint.n]
+		}
+		for _, area := range areas {
+			hints = append(hints, fmt.Sprintf(hint.format, area))
+		}
+	}
+
+	return hints
+}
+
+// returns the string with its first letter in uppercase.
+func capitalize(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
+
 // formats a string for a text box. text box. this doesn't include control
 // characters, except for newlines.
 func (h *hinter) format(s string) string {
@@ -1,6 +1,7 @@
 package randomizer
 
 import (
+	"context"
 	"strings"
 	"testing"
 )
@@ -54,3 +55,56 @@ func TestDanglingHints(t *testing.T) {
 		}
 	}
 }
+
+func TestOwlHints(t *testing.T) {
+	for _, s := range []string{"woth=x", "woth", "nonsense=1", "barren=-1"} {
+		if _, err := parseHintMix(s); err == nil {
+			t.Errorf("invalid hint mix accepted: %q", s)
+		}
+	}
+
+	mix, err := parseHintMix("woth=2,barren=2,always=2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	logf := func(string, ...interface{}) {}
+	for _, game := range []int{gameSeasons, gameAges} {
+		rom := newRomState(nil, game)
+		ri, err := findRoute(context.Background(), rom, 0x1234,
+			randomizerOptions{}, false, logf)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		checks := getChecks(ri.usedItems, ri.usedSlots)
+		owlNames := orderedKeys(getOwlIds(game))
+		hints := newHinter(game).generate(
+			ri.src, ri.graph, checks, owlNames, mix, rom.treasures)
+
+		counts := make(map[string]int)
+		seen := make(map[string]bool)
+		for _, owlName := range owlNames {
+			hint := strings.ReplaceAll(hints[owlName], "\n", " ")
+			if !isValidGameText(hint) {
+				t.Errorf("%s: invalid hint text: %q", gameNames[game], hint)
+			}
+			if seen[hint] {
+				t.Errorf("%s: duplicate hint: %q", gameNames[game], hint)
+			}
+			seen[hint] = true
+
+			switch {
+			case strings.HasSuffix(hint, "on the way of the hero."):
+				counts[hintWoth]++
+			case strings.HasSuffix(hint, "is barren."):
+				counts[hintBarren]++
+			}
+		}
+		for _, kind := range []string{hintWoth, hintBarren} {
+			if counts[kind] != mix[kind] {
+				t.Errorf("%s: %d %s hints, expected %d", gameNames[game],
+					counts[kind], kind, mix[kind])
+			}
+		}
+	}
+}
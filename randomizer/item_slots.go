@@ -94,13 +94,13 @@ func (rom *romState) loadSlots() map[string]*itemSlot {
 
 	filename := fmt.Sprintf("/romdata/%s_slots.yaml", gameNames[rom.game])
 	if err := yaml.Unmarshal(
-		FSMustByte(false, filename), raws); err != nil {
+		mustReadData(filename), raws); err != nil {
 		panic(err)
 	}
 
 	allMusic := make(map[string](map[byte]musicData))
 	if err := yaml.Unmarshal(
-		FSMustByte(false, "/romdata/music.yaml"), allMusic); err != nil {
+		mustReadData("/romdata/music.yaml"), allMusic); err != nil {
 		panic(err)
 	}
 	musicMap := allMusic[gameNames[rom.game]]
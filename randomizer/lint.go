@@ -0,0 +1,296 @@
+package randomizer
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// implements the lint devcmd, which checks the logic files for problems that
+// the randomizer wouldn't notice on its own, like references to nodes that
+// don't exist (which are silently ignored when building the graph).
+//
+// reachability is checked in a permissive world: every item in the vanilla
+// item pool is given, along with every ring, flute, companion region, and
+// default season. so a node that's unreachable in lint is unreachable in any
+// seed.
+
+// nested nodes are named after their parents, plus a number.
+var nestedNodeRegexp = regexp.MustCompile(` \d+$`)
+
+// returns the logic files for a game, by filename.
+func getLogicSources(game int) map[string][]byte {
+	sources := make(map[string][]byte)
+	for _, filename := range logicFiles[game] {
+		sources[filename] = mustReadData("/logic/" + filename)
+	}
+	return sources
+}
+
+// returns a list of problems with the given logic files for a game, each
+// prefixed by the file and key it concerns.
+func lintLogic(game int, sources map[string][]byte) []string {
+	problems := make([]string, 0)
+	report := func(file, key, format string, a ...interface{}) {
+		problems = append(problems, fmt.Sprintf("%s: %s: %s",
+			file, key, fmt.Sprintf(format, a...)))
+	}
+
+	// load files separately to know where each key is from
+	nodes := make(map[string]*prenode)
+	files := make(map[string]string)
+	for _, filename := range orderedKeys(sources) {
+		m, err := parseLogic(filename, sources[filename])
+		if err != nil {
+			problems = append(problems, err.Error())
+			continue
+		}
+		for _, key := range orderedKeys(m) {
+			if files[key] != "" {
+				report(filename, key, "duplicate of key in %s", files[key])
+			}
+			nodes[key], files[key] = m[key], filename
+		}
+	}
+	if len(problems) > 0 {
+		return problems // can't build a graph
+	}
+	flattenNestedPrenodes(nodes)
+
+	// returns the file and top-level key that a (nested) node is from
+	origin := func(name string) (string, string) {
+		for key := name; ; key = nestedNodeRegexp.ReplaceAllString(key, "") {
+			if files[key] != "" {
+				return files[key], key
+			}
+			if !nestedNodeRegexp.MatchString(key) {
+				return "", name
+			}
+		}
+	}
+
+	// tricks need parentless nodes to link to
+	for _, name := range getTricks(game) {
+		if pn := nodes[name]; pn == nil || pn.nType != orNode ||
+			len(pn.parents) > 0 {
+			report("tricks.yaml", name, "trick needs an or node with no parents")
+		}
+	}
+
+	// item slots and their vanilla items
+	rom := newRomState(nil, game)
+	slotsFile := fmt.Sprintf("romdata/%s_slots.yaml", gameNames[game])
+	items := make([]string, 0, len(rom.itemSlots))
+	for _, name := range orderedKeys(rom.itemSlots) {
+		if nodes[name] == nil {
+			report(slotsFile, name, "slot has no logic")
+		}
+		tName, _ := reverseLookup(rom.treasures, rom.itemSlots[name].treasure)
+		items = append(items, tName.(string))
+	}
+	for _, name := range items {
+		if files[name] != "" && len(nodes[name].parents) > 0 {
+			report(files[name], name, "item node is replaced by item")
+		}
+		nodes[name] = rootPrenode()
+	}
+
+	// references, and what types of nodes they're used in
+	children := make(map[string][]string)
+	for _, name := range orderedKeys(nodes) {
+		pn := nodes[name]
+		for _, parent := range pn.parents {
+			parent := parent.(string)
+			children[parent] = append(children[parent], name)
+			if nodes[parent] == nil {
+				file, key := origin(name)
+				report(file, key, "reference to nonexistent node %q", parent)
+			}
+			if pn.nType == rupeesNode && rupeeValues[parent] == 0 {
+				file, key := origin(name)
+				report(file, key, "rupees parent %q has no rupee value",
+					parent)
+			}
+		}
+	}
+	for _, name := range orderedKeys(nodes) {
+		if nodes[name].nType != rupeesNode {
+			continue
+		}
+		for _, child := range children[name] {
+			if nodes[child].nType != countNode {
+				file, key := origin(child)
+				report(file, key, "rupees node %q used outside of count",
+					name)
+			}
+		}
+	}
+
+	// reachability. nodes can also be referenced by links made in code.
+	g := newLintGraph(rom, nodes, items)
+	owls := getOwlIds(game)
+	for _, name := range orderedKeys(files) {
+		if len(g[name].children) == 0 && rom.itemSlots[name] == nil &&
+			name != "done" && rupeeValues[name] == 0 &&
+			getStringIndex(rings, name) == -1 && !containsKey(owls, name) {
+			report(files[name], name, "node is never referenced")
+		}
+	}
+
+	g.reset()
+	g["start"].explore()
+	normal := make(map[string]bool)
+	for name, n := range g {
+		normal[name] = n.reached
+	}
+	linkTricks(g, getTricks(game))
+	g.reset()
+	g["start"].explore()
+
+	unreached := make(map[string]bool)
+	for name, n := range g {
+		if !n.reached {
+			unreached[name] = true
+		}
+	}
+	inCycle := make(map[string]bool)
+	for _, cycle := range findCycles(g, unreached) {
+		for _, name := range cycle {
+			inCycle[name] = true
+		}
+		file, key := origin(cycle[0])
+		report(file, key, "unsatisfiable cycle among %s",
+			strings.Join(cycle, ", "))
+	}
+	for _, name := range orderedKeys(files) {
+		// or nodes with no parents are unreachable on purpose
+		pn := nodes[name]
+		if unreached[name] && !inCycle[name] &&
+			(pn.nType != orNode || len(pn.parents) > 0) {
+			report(files[name], name, "node is unreachable")
+		}
+	}
+	for _, name := range orderedKeys(rom.itemSlots) {
+		if g[name] != nil && g[name].reached && !normal[name] {
+			report(files[name], name, "slot is only reachable with tricks")
+		}
+	}
+
+	sort.Strings(problems)
+	return problems
+}
+
+// returns a graph of the given prenodes, connected to start as permissively
+// as possible. items are given once for each time they appear in the vanilla
+// item pool, so that count nodes work.
+func newLintGraph(rom *romState, nodes map[string]*prenode,
+	items []string) graph {
+	g := newGraph()
+	addNodes(nodes, g)
+	addNodeParents(nodes, g)
+
+	link := func(name string) {
+		if n := g[name]; n != nil {
+			n.addParent(g["start"])
+		}
+	}
+	for _, name := range items {
+		link(name)
+	}
+	for _, name := range rings {
+		if getStringIndex(items, name) == -1 {
+			link(name)
+		}
+	}
+	for _, name := range []string{"ricky's flute", "dimitri's flute",
+		"moosh's flute", "natzu prairie", "natzu river", "natzu wasteland",
+		"ricky nuun", "dimitri nuun", "moosh nuun"} {
+		if getStringIndex(items, name) == -1 {
+			link(name)
+		}
+	}
+
+	src := rand.New(rand.NewSource(0))
+	if rom.game == gameSeasons {
+		for _, area := range seasonAreas {
+			for _, season := range seasonsById {
+				link(fmt.Sprintf("%s default %s", area, season))
+			}
+		}
+		setPortals(src, g, false)
+	}
+	setDungeonEntrances(src, g, rom.game, false)
+
+	return g
+}
+
+// returns the cycles among the given nodes in the graph, as lists of node
+// names. only strongly connected components of unreached nodes count, since
+// a cycle with a reachable member isn't a problem.
+func findCycles(g graph, among map[string]bool) [][]string {
+	// tarjan's algorithm, following parent links
+	index, low := make(map[string]int), make(map[string]int)
+	onStack := make(map[string]bool)
+	stack := make([]string, 0)
+	cycles := make([][]string, 0)
+
+	var visit func(name string)
+	visit = func(name string) {
+		index[name], low[name] = len(index), len(index)
+		stack = append(stack, name)
+		onStack[name] = true
+
+		selfLoop := false
+		for _, parent := range g[name].parents {
+			switch {
+			case parent.name == name:
+				selfLoop = true
+			case !among[parent.name]:
+				continue
+			case !containsKey(index, parent.name):
+				visit(parent.name)
+				if low[parent.name] < low[name] {
+					low[name] = low[parent.name]
+				}
+			case onStack[parent.name] && index[parent.name] < low[name]:
+				low[name] = index[parent.name]
+			}
+		}
+
+		if low[name] == index[name] {
+			component := make([]string, 0)
+			for {
+				top := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				onStack[top] = false
+				component = append(component, top)
+				if top == name {
+					break
+				}
+			}
+			if len(component) > 1 || selfLoop {
+				sort.Strings(component)
+				cycles = append(cycles, component)
+			}
+		}
+	}
+
+	for _, name := range orderedKeys(among) {
+		if !containsKey(index, name) {
+			visit(name)
+		}
+	}
+
+	sort.Slice(cycles, func(i, j int) bool {
+		return cycles[i][0] < cycles[j][0]
+	})
+	return cycles
+}
+
+// returns true if the map has the key. the map must have string keys.
+func containsKey(m interface{}, key string) bool {
+	return reflect.ValueOf(m).MapIndex(reflect.ValueOf(key)).IsValid()
+}
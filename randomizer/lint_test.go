@@ -0,0 +1,48 @@
+package randomizer
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLint(t *testing.T) {
+	// the real logic shouldn't have any structural errors
+	for _, game := range []int{gameSeasons, gameAges} {
+		for _, problem := range lintLogic(game, getLogicSources(game)) {
+			if strings.Contains(problem, "nonexistent") ||
+				strings.Contains(problem, "duplicate") ||
+				strings.Contains(problem, "cycle") {
+				t.Errorf("%s: %s", gameNames[game], problem)
+			}
+		}
+	}
+
+	// and bad logic should be caught
+	sources := getLogicSources(gameSeasons)
+	sources["bad.yaml"] = []byte(`
+bad reference: [start, no such node]
+bad cycle a: [bad cycle b]
+bad cycle b: [bad cycle a]
+bad rupees: {rupees: [start]}
+unreferenced: [start]
+`)
+	want := []string{
+		`bad.yaml: bad reference: reference to nonexistent node "no such node"`,
+		"bad.yaml: bad cycle a: unsatisfiable cycle among " +
+			"bad cycle a, bad cycle b",
+		`bad.yaml: bad rupees: rupees parent "start" has no rupee value`,
+		"bad.yaml: unreferenced: node is never referenced",
+	}
+	problems := lintLogic(gameSeasons, sources)
+	for _, s := range want {
+		if getStringIndex(problems, s) == -1 {
+			t.Errorf("missing problem %q in %q", s, problems)
+		}
+	}
+
+	sources["bad.yaml"] = []byte("bad count: {count: [0, start]}\n")
+	problems = lintLogic(gameSeasons, sources)
+	if len(problems) != 1 || !strings.HasPrefix(problems[0], "bad.yaml: ") {
+		t.Errorf("expected one count error in bad.yaml, got %q", problems)
+	}
+}
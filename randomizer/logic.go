@@ -2,6 +2,7 @@ package randomizer
 
 import (
 	"fmt"
+	"sync"
 
 	"gopkg.in/yaml.v2"
 )
@@ -23,28 +24,56 @@ func rootPrenode(parents ...interface{}) *prenode {
 	return &prenode{parents: parents, nType: orNode}
 }
 
-var seasonsPrenodes, agesPrenodes map[string]*prenode
+// the logic files for each game, in the logic/ directory.
+var logicFiles = map[int][]string{
+	gameSeasons: []string{"rings.yaml", "seasons_items.yaml",
+		"seasons_kill.yaml", "holodrum.yaml", "subrosia.yaml", "portals.yaml",
+		"seasons_dungeons.yaml"},
+	gameAges: []string{"rings.yaml", "ages_items.yaml", "ages_kill.yaml",
+		"labrynna.yaml", "ages_dungeons.yaml"},
+}
+
+var (
+	seasonsPrenodes, agesPrenodes map[string]*prenode
+	loadPrenodesOnce              sync.Once
+)
 
 func init() {
-	seasonsPrenodes = make(map[string]*prenode)
-	appendPrenodes(seasonsPrenodes, loadLogic("rings.yaml"),
-		loadLogic("seasons_items.yaml"), loadLogic("seasons_kill.yaml"),
-		loadLogic("holodrum.yaml"), loadLogic("subrosia.yaml"),
-		loadLogic("portals.yaml"), loadLogic("seasons_dungeons.yaml"))
-	flattenNestedPrenodes(seasonsPrenodes)
-
-	agesPrenodes = make(map[string]*prenode)
-	appendPrenodes(agesPrenodes, loadLogic("rings.yaml"),
-		loadLogic("ages_items.yaml"), loadLogic("ages_kill.yaml"),
-		loadLogic("labrynna.yaml"), loadLogic("ages_dungeons.yaml"))
-	flattenNestedPrenodes(agesPrenodes)
-
-	err := yaml.Unmarshal(FSMustByte(false, "/romdata/rings.yaml"), &rings)
+	loadRings()
+}
+
+// loads the list of ring names.
+func loadRings() {
+	rings = nil
+	err := yaml.Unmarshal(mustReadData("/romdata/rings.yaml"), &rings)
 	if err != nil {
 		panic(err)
 	}
 }
 
+// loads all the logic for a game, applying the overlay if it's non-nil.
+// errors include the filename and key.
+func loadGameLogic(
+	game int, overlay *logicOverlay) (map[string]*prenode, error) {
+	nodes := make(map[string]*prenode)
+	for _, filename := range logicFiles[game] {
+		m, err := loadLogic(filename)
+		if err != nil {
+			return nil, err
+		}
+		if err := appendPrenodes(nodes, m); err != nil {
+			return nil, fmt.Errorf("%s: %v", filename, err)
+		}
+	}
+	if overlay != nil {
+		if err := overlay.apply(nodes, game); err != nil {
+			return nil, err
+		}
+	}
+	flattenNestedPrenodes(nodes)
+	return nodes, nil
+}
+
 // add nested nodes to the map and turn their references into strings, adding
 // an interger suffix to the successive parents of a node.
 func flattenNestedPrenodes(nodes map[string]*prenode) {
@@ -70,9 +99,28 @@ func flattenNestedPrenodes(nodes map[string]*prenode) {
 	}
 }
 
-// returns a copy of all prenodes for the given game.
-func getPrenodes(game int) map[string]*prenode {
+// returns a copy of all prenodes for the given game, with the overlay applied
+// if it's non-nil. logic is loaded the first time this is called, so that the
+// lint devcmd can report errors in it. overlays should be loaded beforehand
+// to check for errors.
+func getPrenodes(game int, overlay *logicOverlay) map[string]*prenode {
+	loadPrenodesOnce.Do(func() {
+		var err error
+		if seasonsPrenodes, err = loadGameLogic(gameSeasons, nil); err != nil {
+			panic(err)
+		}
+		if agesPrenodes, err = loadGameLogic(gameAges, nil); err != nil {
+			panic(err)
+		}
+	})
+
 	src := sora(game, seasonsPrenodes, agesPrenodes).(map[string]*prenode)
+	if overlay != nil {
+		var err error
+		if src, err = overlay.load(game); err != nil {
+			panic(err)
+		}
+	}
 	dst := make(map[string]*prenode, len(src))
 	for k, v := range src {
 		dst[k] = v
@@ -81,89 +129,121 @@ func getPrenodes(game int) map[string]*prenode {
 }
 
 // merges the given prenode maps into the first argument.
-func appendPrenodes(total map[string]*prenode, maps ...map[string]*prenode) {
+func appendPrenodes(total map[string]*prenode,
+	maps ...map[string]*prenode) error {
 	for _, nodeMap := range maps {
 		for k, v := range nodeMap {
 			if _, ok := total[k]; ok {
-				panic("duplicate logic key: " + k)
+				return fmt.Errorf("duplicate logic key: %s", k)
 			}
 			total[k] = v
 		}
 	}
+	return nil
 }
 
 // loads a logic map from yaml.
-func loadLogic(filename string) map[string]*prenode {
+func loadLogic(filename string) (map[string]*prenode, error) {
+	b, err := readData("/logic/" + filename)
+	if err != nil {
+		return nil, err
+	}
+	return parseLogic(filename, b)
+}
+
+// parses a logic map from yaml. filename is only used in errors.
+func parseLogic(filename string, b []byte) (map[string]*prenode, error) {
 	raw := make(map[string]interface{})
-	if err := yaml.Unmarshal(
-		FSMustByte(false, "/logic/"+filename), raw); err != nil {
-		panic(err)
+	if err := yaml.Unmarshal(b, raw); err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
 	}
 	m := make(map[string]*prenode)
-	for k, v := range raw {
-		m[k] = loadNode(v)
+	for _, k := range orderedKeys(raw) {
+		n, err := loadNode(raw[k])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s: %v", filename, k, err)
+		}
+		m[k] = n
 	}
-	return m
+	return m, nil
 }
 
 // loads a node (and any of its explicit parents, recursively) from yaml.
-func loadNode(v interface{}) *prenode {
+func loadNode(v interface{}) (*prenode, error) {
 	n := new(prenode)
 
 	switch v := v.(type) {
 	case []interface{}: // and node
 		n.nType = andNode
-		n.parents = make([]interface{}, len(v))
-		for i, parent := range v {
-			switch parent.(type) {
-			case string:
-				n.parents[i] = parent
-			default:
-				n.parents[i] = loadNode(parent)
-			}
+		parents, err := loadParents(v)
+		if err != nil {
+			return nil, err
 		}
+		n.parents = parents
 	case map[interface{}]interface{}: // other node
+		if len(v) != 1 {
+			return nil, fmt.Errorf("node must have exactly one type: %v", v)
+		}
+		var err error
 		switch {
 		case v["or"] != nil:
 			n.nType = orNode
-			n.parents = loadParents(v["or"])
+			n.parents, err = loadParents(v["or"])
 		case v["count"] != nil:
 			n.nType = countNode
-			n.minCount = v["count"].([]interface{})[0].(int)
-			n.parents = make([]interface{}, 1)
-			n.parents[0] = v["count"].([]interface{})[1].(string)
+			args, ok := v["count"].([]interface{})
+			if !ok || len(args) != 2 {
+				return nil, fmt.Errorf("count needs a minimum and a parent")
+			}
+			min, ok := args[0].(int)
+			if !ok || min < 1 {
+				return nil, fmt.Errorf("invalid count minimum: %v", args[0])
+			}
+			parent, ok := args[1].(string)
+			if !ok {
+				return nil, fmt.Errorf("invalid count parent: %v", args[1])
+			}
+			n.minCount, n.parents = min, []interface{}{parent}
 		case v["rupees"] != nil:
 			n.nType = rupeesNode
-			n.parents = loadParents(v["rupees"])
+			n.parents, err = loadParents(v["rupees"])
 		default:
-			panic(fmt.Sprintf("unknown logic type: %v", v))
+			return nil, fmt.Errorf("unknown logic type: %v", v)
+		}
+		if err != nil {
+			return nil, err
 		}
+	case nil:
+		return nil, fmt.Errorf("empty node")
+	default:
+		return nil, fmt.Errorf("invalid node: %v", v)
 	}
 
-	return n
+	return n, nil
 }
 
 // loads a node's parents from yaml.
-func loadParents(v interface{}) []interface{} {
-	var parents []interface{}
+func loadParents(v interface{}) ([]interface{}, error) {
+	a, ok := v.([]interface{})
+	if !ok { // single parent, other node
+		a = []interface{}{v}
+	}
 
-	switch v := v.(type) {
-	case []interface{}: // and node
-		parents = make([]interface{}, len(v))
-		for i, parent := range v {
-			switch parent.(type) {
-			case string:
-				parents[i] = parent
-			default:
-				parents[i] = loadNode(parent)
+	parents := make([]interface{}, len(a))
+	for i, parent := range a {
+		switch parent := parent.(type) {
+		case string:
+			parents[i] = parent
+		default:
+			n, err := loadNode(parent)
+			if err != nil {
+				return nil, err
 			}
+			parents[i] = n
 		}
-	default: // single parent, other node
-		parents = make([]interface{}, 1)
-		parents[0] = loadNode(v)
 	}
 
-	return parents
+	return parents, nil
 }
 
 var rupeeValues = map[string]int{
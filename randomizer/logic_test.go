@@ -16,7 +16,7 @@ func TestLinks(t *testing.T) {
 }
 
 func testLinksForGame(t *testing.T, game int) {
-	nodes := getPrenodes(game)
+	nodes := getPrenodes(game, nil)
 	rom := newRomState(nil, game)
 
 	for key, slot := range rom.itemSlots {
@@ -1,6 +1,8 @@
 package randomizer
 
 import (
+	"bytes"
+	"context"
 	"crypto/sha1"
 	"flag"
 	"fmt"
@@ -20,6 +22,7 @@ import (
 type logFunc func(string, ...interface{})
 
 var keyRegexp = regexp.MustCompile("(slate|(small|boss) key)$")
+var mapRegexp = regexp.MustCompile("(compass|dungeon map)$")
 
 const (
 	gameNil = iota
@@ -38,6 +41,13 @@ var gameNames = map[int]string{
 func usage() {
 	fmt.Fprintf(flag.CommandLine.Output(),
 		"Usage: %s [<original file> [<new file>]]\n", os.Args[0])
+	fmt.Fprintf(flag.CommandLine.Output(),
+		"       %s apply <patch> <vanilla ROM> [<new file>]\n", os.Args[0])
+	fmt.Fprintf(flag.CommandLine.Output(),
+		"       %s extract <randomized ROM> [<vanilla ROM> [<new file>]]\n",
+		os.Args[0])
+	fmt.Fprintf(flag.CommandLine.Output(),
+		"       %s serve [<address> [<vanilla ROM>...]]\n", os.Args[0])
 	flag.PrintDefaults()
 }
 
@@ -54,55 +64,206 @@ func printErrf(s string, a ...interface{}) {
 
 // options specified on the command line or via the TUI
 var (
-	flagCpuProf  string
-	flagDevCmd   string
-	flagDungeons bool
-	flagHard     bool
-	flagNoUI     bool
-	flagPlan     string
-	flagPortals  bool
-	flagSeed     string
-	flagRace     bool
-	flagTreewarp bool
-	flagVerbose  bool
+	flagAsm         string
+	flagCpuProf     string
+	flagDataDir     string
+	flagDevCmd      string
+	flagBossOnly    bool
+	flagDungeons    bool
+	flagEssences    int
+	flagExclude     string
+	flagFill        string
+	flagHard        bool
+	flagHints       bool
+	flagHintMix     string
+	flagKeys        string
+	flagOverlay     string
+	flagMaps        string
+	flagNoUI        bool
+	flagPlan        string
+	flagPatch       string
+	flagPatchOnly   bool
+	flagPlaythrough bool
+	flagPreset      string
+	flagPortals     bool
+	flagSeed        string
+	flagSettings    string
+	flagStart       string
+	flagSym         bool
+	flagRace        bool
+	flagRules       string
+	flagTreewarp    bool
+	flagTricks      string
+	flagVerbose     bool
+	flagWorkers     int
 )
 
 type randomizerOptions struct {
-	treewarp bool
-	hard     bool
-	dungeons bool
-	portals  bool
-	plan     *plan
-	race     bool
-	seed     string
+	treewarp    bool
+	hard        bool
+	dungeons    bool
+	portals     bool
+	essences    int  // 0 means all 8
+	bossOnly    bool // no essences needed
+	fill        string
+	keys        string
+	maps        string
+	starting    []string
+	excluded    []string // slots that can only hold inert items
+	plan        *plan
+	placement   placementRules
+	tricks      []string // hard enables all of them
+	overlay     *logicOverlay
+	asmPacks    []*asmData
+	hints       bool
+	hintMix     string // empty for the default
+	race        bool
+	seed        string
+	playthrough bool // include a minimal playthrough in the spoiler log
+}
+
+// returns an error if the options are invalid for the given game. if the game
+// is gameNil, only checks that don't depend on the game are done.
+func (ropts randomizerOptions) validate(game int) error {
+	if ropts.portals && game == gameAges {
+		return fmt.Errorf("portal randomization does not apply to ages")
+	}
+	if ropts.fill != "" && getStringIndex(fillAlgorithms, ropts.fill) == -1 {
+		return fmt.Errorf("unknown fill algorithm: %s", ropts.fill)
+	}
+	if ropts.keys != "" && getStringIndex(keysanityLevels, ropts.keys) == -1 {
+		return fmt.Errorf("unknown keysanity level: %s", ropts.keys)
+	}
+	if ropts.maps != "" && getStringIndex(mapsLevels, ropts.maps) == -1 {
+		return fmt.Errorf("unknown map and compass shuffle: %s", ropts.maps)
+	}
+	if _, err := ropts.getHintMix(); err != nil {
+		return err
+	}
+	if ropts.essences < 0 || ropts.essences > 8 {
+		return fmt.Errorf("essence count must be 0 to 8 (0 means all 8)")
+	}
+	if ropts.bossOnly && ropts.essences != 0 && ropts.essences != 8 {
+		return fmt.Errorf("can't require essences with boss only")
+	}
+	if ropts.plan != nil && len(ropts.placement) > 0 {
+		return fmt.Errorf("placement rules don't apply to plans")
+	}
+
+	// the rest depends on the game
+	if game == gameNil {
+		return nil
+	}
+	if err := validateTricks(game, ropts.tricks); err != nil {
+		return err
+	}
+	if ropts.overlay != nil {
+		if _, err := ropts.overlay.load(game); err != nil {
+			return err
+		}
+	}
+	return validateStartingItems(ropts.starting, game)
+}
+
+// returns the number of essences needed for the maku seed.
+func (ropts randomizerOptions) requiredEssences() int {
+	if ropts.bossOnly {
+		return 0
+	} else if ropts.essences == 0 {
+		return 8
+	}
+	return ropts.essences
+}
+
+// returns the numbers of each type of owl hint to give.
+func (ropts randomizerOptions) getHintMix() (hintMix, error) {
+	if ropts.hintMix == "" {
+		return parseHintMix(defaultHintMix)
+	}
+	return parseHintMix(ropts.hintMix)
+}
+
+// returns the rules for placing dungeon items under these options.
+func (ropts randomizerOptions) dungeonItemRules() dungeonItemRules {
+	return dungeonItemRules{keys: ropts.keys, maps: ropts.maps}
 }
 
 // initFlags initializes the CLI/TUI option values and variables.
 func initFlags() {
 	flag.Usage = usage
-	flag.StringVar(&flagCpuProf, "cpuprofile", "",
+	defineFlags(flag.CommandLine)
+	flag.Parse()
+}
+
+// defines the command-line flags in a flag set.
+func defineFlags(fs *flag.FlagSet) {
+	fs.StringVar(&flagAsm, "asm", "",
+		"semicolon-separated list of asm files or directories to apply")
+	fs.StringVar(&flagCpuProf, "cpuprofile", "",
 		"write CPU profile to file")
-	flag.StringVar(&flagDevCmd, "devcmd", "",
-		"subcommands are 'findaddr', 'showasm', and 'stats'")
-	flag.BoolVar(&flagDungeons, "dungeons", false,
+	fs.StringVar(&flagDataDir, "datadir", os.Getenv("ORACLES_DATADIR"),
+		"read asm, hints, logic, and romdata files from a directory first "+
+			"(or set ORACLES_DATADIR)")
+	fs.BoolVar(&flagBossOnly, "bossonly", false,
+		"only require beating the final boss (no essences)")
+	fs.StringVar(&flagDevCmd, "devcmd", "",
+		"subcommands are 'findaddr', 'graph', 'lint', 'need', 'showasm', "+
+			"and 'stats'")
+	fs.BoolVar(&flagDungeons, "dungeons", false,
 		"shuffle dungeon entrances")
-	flag.BoolVar(&flagHard, "hard", false,
+	fs.IntVar(&flagEssences, "essences", 8,
+		"number of essences needed for the maku seed (0 means all 8)")
+	fs.StringVar(&flagExclude, "exclude", "",
+		"semicolon-separated list of checks that can't hold progression")
+	fs.StringVar(&flagFill, "fill", fillForward,
+		"item placement algorithm: 'forward' or 'assumed'")
+	fs.BoolVar(&flagHard, "hard", false,
 		"enable more difficult logic")
-	flag.BoolVar(&flagNoUI, "noui", false,
+	fs.BoolVar(&flagHints, "hints", false,
+		"give hints in owl statue messages")
+	fs.StringVar(&flagHintMix, "hintmix", defaultHintMix,
+		"numbers of owl hints by type: 'woth', 'barren', and 'always'")
+	fs.StringVar(&flagKeys, "keysanity", keysOwnDungeon,
+		"where dungeon keys can go: 'off', 'dungeons', or 'anywhere'")
+	fs.StringVar(&flagOverlay, "logic-overlay", "",
+		"yaml file of changes to the logic")
+	fs.StringVar(&flagMaps, "maps", mapsOwnDungeon,
+		"where maps and compasses can go: 'dungeon', 'anywhere', or 'vanilla'")
+	fs.BoolVar(&flagNoUI, "noui", false,
 		"use command line without prompts if input file is given")
-	flag.StringVar(&flagPlan, "plan", "",
+	fs.StringVar(&flagPlan, "plan", "",
 		"use fixed 'randomization' from a file")
-	flag.BoolVar(&flagPortals, "portals", false,
+	fs.StringVar(&flagPatch, "patch", "",
+		"also write a patch: 'bps', 'ips', or 'both'")
+	fs.BoolVar(&flagPatchOnly, "patchonly", false,
+		"write only the patch, not the randomized ROM")
+	fs.StringVar(&flagPreset, "preset", "",
+		"load options from a yaml file or built-in preset: "+
+			"'beginner', 'hard', or 'league'")
+	fs.BoolVar(&flagPlaythrough, "playthrough", false,
+		"list only the checks needed to beat the seed in the log")
+	fs.BoolVar(&flagPortals, "portals", false,
 		"shuffle subrosia portal connections (seasons)")
-	flag.BoolVar(&flagRace, "race", false,
+	fs.BoolVar(&flagRace, "race", false,
 		"don't print full seed in file select screen or filename")
-	flag.StringVar(&flagSeed, "seed", "",
+	fs.StringVar(&flagRules, "rules", "",
+		"load item placement rules from a yaml file")
+	fs.StringVar(&flagSeed, "seed", "",
 		"specific random seed to use (32-bit hex number)")
-	flag.BoolVar(&flagTreewarp, "treewarp", false,
+	fs.StringVar(&flagSettings, "settings", "",
+		"use the seed and options from a settings string")
+	fs.StringVar(&flagStart, "start", "",
+		"semicolon-separated list of items to start with")
+	fs.BoolVar(&flagSym, "sym", false,
+		"also write a symbol file for debugging in BGB or mGBA")
+	fs.BoolVar(&flagTreewarp, "treewarp", false,
 		"warp to ember tree by pressing start+B on map screen")
-	flag.BoolVar(&flagVerbose, "verbose", false,
+	fs.StringVar(&flagTricks, "tricks", "",
+		"semicolon-separated list of tricks to allow in logic")
+	fs.BoolVar(&flagVerbose, "verbose", false,
 		"print more detailed output to terminal")
-	flag.Parse()
+	fs.IntVar(&flagWorkers, "workers", 2,
+		"number of seeds to generate at once in serve mode")
 }
 
 // the program's entry point.
@@ -119,13 +280,82 @@ func Main() {
 		defer pprof.StopCPUProfile()
 	}
 
+	if flagDataDir != "" {
+		paths, err := setDataDir(flagDataDir)
+		if err != nil {
+			fatal(err, printErrf)
+			return
+		}
+		for _, path := range paths {
+			printErrf("overriding %s from %s", path, flagDataDir)
+		}
+	}
+
+	if flagSettings != "" {
+		if err := checkSettingsFlags(flag.CommandLine); err != nil {
+			fatal(err, printErrf)
+			return
+		}
+	}
+
+	if flagPreset != "" {
+		source, err := loadPreset(flagPreset)
+		if err == nil {
+			err = applyPreset(flag.CommandLine, source)
+		}
+		if err != nil {
+			fatal(err, printErrf)
+			return
+		}
+	}
+
 	ropts := randomizerOptions{
-		treewarp: flagTreewarp,
-		hard:     flagHard,
-		dungeons: flagDungeons,
-		portals:  flagPortals,
-		race:     flagRace,
-		seed:     flagSeed,
+		treewarp:    flagTreewarp,
+		hard:        flagHard,
+		dungeons:    flagDungeons,
+		portals:     flagPortals,
+		essences:    flagEssences,
+		bossOnly:    flagBossOnly,
+		fill:        flagFill,
+		hints:       flagHints,
+		hintMix:     flagHintMix,
+		keys:        flagKeys,
+		maps:        flagMaps,
+		starting:    parseNameList(flagStart),
+		excluded:    parseNameList(flagExclude),
+		tricks:      parseNameList(flagTricks),
+		race:        flagRace,
+		seed:        flagSeed,
+		playthrough: flagPlaythrough,
+	}
+	if flagOverlay != "" {
+		b, err := ioutil.ReadFile(flagOverlay)
+		if err == nil {
+			ropts.overlay, err = newLogicOverlay(flagOverlay, b)
+		}
+		if err != nil {
+			fatal(err, printErrf)
+			return
+		}
+	}
+	if flagAsm != "" {
+		var err error
+		if ropts.asmPacks, err = loadAsmPacks(
+			parseNameList(flagAsm)); err != nil {
+			fatal(err, printErrf)
+			return
+		}
+	}
+	if err := ropts.validate(gameNil); err != nil {
+		fatal(err, printErrf)
+		return
+	}
+	if flagPatch != "" && getStringIndex(patchFormats, flagPatch) == -1 {
+		fatal(fmt.Errorf("unknown patch format: %s", flagPatch), printErrf)
+		return
+	} else if flagPatchOnly && flagPatch == "" {
+		fatal(fmt.Errorf("-patchonly requires -patch"), printErrf)
+		return
 	}
 
 	switch flagDevCmd {
@@ -184,6 +414,63 @@ func Main() {
 			fmt.Printf(s, a...)
 			fmt.Println()
 		})
+	case "graph":
+		// write the logic graph, or the ancestors of one node, to a file
+		tokens := strings.SplitN(flag.Arg(0), "/", 2)
+		game := reverseLookupOrPanic(gameNames, tokens[0]).(int)
+		root := ""
+		if len(tokens) == 2 {
+			root = tokens[1]
+		}
+		var err error
+		if ropts.placement, err = getFlagRules(game); err != nil {
+			fatal(err, printErrf)
+			return
+		}
+		if err := exportGraph(game, root, flag.Arg(1), ropts); err != nil {
+			fatal(err, printErrf)
+			return
+		}
+	case "lint":
+		// check the logic files of one or both games for problems
+		games := []int{gameSeasons, gameAges}
+		if flag.Arg(0) != "" {
+			games = []int{reverseLookupOrPanic(gameNames, flag.Arg(0)).(int)}
+		}
+
+		n := 0
+		for _, game := range games {
+			for _, problem := range lintLogic(game, getLogicSources(game)) {
+				fmt.Printf("%s: %s\n", gameNames[game], problem)
+				n++
+			}
+		}
+		if n > 0 {
+			fatal(fmt.Errorf("lint: %d problem(s) found", n), printErrf)
+			return
+		}
+		fmt.Println("no problems found")
+	case "need":
+		// print what items are needed to reach the target nodes
+		game := reverseLookupOrPanic(gameNames, flag.Arg(0)).(int)
+		q, err := parseNeedQuery(game, flag.Arg(1), flag.Arg(2), ropts)
+		if err != nil {
+			fatal(err, printErrf)
+			return
+		}
+
+		r := q.run()
+		switch {
+		case r.reachable:
+			fmt.Println("reachable")
+		case len(r.sets) == 0:
+			fmt.Println("not reachable with any items")
+		default:
+			fmt.Println("not reachable; would be with any of:")
+			for _, set := range r.sets {
+				fmt.Println("  " + formatNeedSet(set))
+			}
+		}
 	case "showasm":
 		// print the asm for the named function/etc
 		tokens := strings.Split(flag.Arg(0), "/")
@@ -201,7 +488,52 @@ func Main() {
 		}
 	case "":
 		// no devcmd, run randomizer normally
-		if flag.NArg() > 0 && flag.NArg()+flag.NFlag() > 1 { // CLI used
+		if flag.Arg(0) == "apply" {
+			// apply <patch> <vanilla ROM> [<new file>]
+			if flag.NArg() < 3 || flag.NArg() > 4 {
+				flag.Usage()
+				return
+			}
+			err := applyPatchFile(flag.Arg(1), flag.Arg(2), flag.Arg(3),
+				func(s string, a ...interface{}) {
+					fmt.Printf(s, a...)
+					fmt.Println()
+				})
+			if err != nil {
+				fatal(err, printErrf)
+			}
+		} else if flag.Arg(0) == "extract" {
+			// extract <randomized ROM> [<vanilla ROM> [<new file>]]
+			if flag.NArg() < 2 || flag.NArg() > 4 {
+				flag.Usage()
+				return
+			}
+			err := extractRomFile(flag.Arg(1), flag.Arg(2), flag.Arg(3),
+				func(s string, a ...interface{}) {
+					fmt.Printf(s, a...)
+					fmt.Println()
+				})
+			if err != nil {
+				fatal(err, printErrf)
+			}
+		} else if flag.Arg(0) == "serve" {
+			// serve [<address> [<vanilla ROM>...]]
+			addr := defaultServeAddr
+			if flag.NArg() > 1 {
+				addr = flag.Arg(1)
+			}
+			var roms []string
+			if flag.NArg() > 2 {
+				roms = flag.Args()[2:]
+			}
+			logf := func(s string, a ...interface{}) {
+				fmt.Printf(s, a...)
+				fmt.Println()
+			}
+			if err := serve(addr, flagWorkers, roms, logf); err != nil {
+				fatal(err, printErrf)
+			}
+		} else if flag.NArg() > 0 && flag.NArg()+flag.NFlag() > 1 { // CLI used
 			// run randomizer on main goroutine
 			runRandomizer(nil, ropts, func(s string, a ...interface{}) {
 				fmt.Printf(s, a...)
@@ -243,13 +575,38 @@ func runRandomizer(ui *uiInstance, ropts randomizerOptions, logf logFunc) {
 		}
 
 		logf("randomizing %s.", infile)
-		getAndLogOptions(game, ui, &ropts, logf)
+		if err := ropts.validate(game); err != nil {
+			fatal(err, logf)
+			return
+		}
+		if flagSettings != "" {
+			if flagPlan != "" {
+				fatal(fmt.Errorf("can't use both -settings and -plan"), logf)
+				return
+			}
+			var err error
+			// not part of settings strings
+			overlay, asmPacks := ropts.overlay, ropts.asmPacks
+			playthrough := ropts.playthrough
+			ropts, err = decodeSettings(flagSettings, game)
+			if err != nil {
+				fatal(err, logf)
+				return
+			}
+			ropts.overlay, ropts.asmPacks = overlay, asmPacks
+			ropts.playthrough = playthrough
+			logf("using seed %s.", ropts.seed)
+			getAndLogOptions(game, nil, &ropts, logf)
+		} else if flagPreset != "" {
+			logf("using preset %s.", flagPreset)
+			getAndLogOptions(game, nil, &ropts, logf)
+		} else {
+			getAndLogOptions(game, ui, &ropts, logf)
+		}
 		if ui != nil {
 			logf("")
 		}
 
-		rom.setTreewarp(ropts.treewarp)
-
 		if flagPlan != "" {
 			var err error
 			ropts.plan, err = parseSummary(flagPlan, game)
@@ -259,6 +616,14 @@ func runRandomizer(ui *uiInstance, ropts randomizerOptions, logf logFunc) {
 			}
 		}
 
+		if flagSettings == "" {
+			var err error
+			if ropts.placement, err = getFlagRules(game); err != nil {
+				fatal(err, logf)
+				return
+			}
+		}
+
 		if err := randomizeFile(
 			rom, dirName, outfile, ropts, flagVerbose, logf); err != nil {
 			fatal(err, logf)
@@ -350,19 +715,50 @@ func getAndLogOptions(game int, ui *uiInstance, ropts *randomizerOptions,
 		}
 		logf("portal shuffle %s.", ternary(ropts.portals, "on", "off"))
 	}
+
+	if ropts.fill == fillAssumed {
+		logf("using assumed fill.")
+	}
+	if ropts.keys == keysAnyDungeon {
+		logf("keys can be placed in any dungeon.")
+	} else if ropts.keys == keysAnywhere {
+		logf("keys can be placed anywhere.")
+	}
+	if ropts.maps == mapsAnywhere {
+		logf("maps and compasses can be placed anywhere.")
+	} else if ropts.maps == mapsVanilla {
+		logf("maps and compasses are in their vanilla locations.")
+	}
+	if ropts.bossOnly {
+		logf("only the final boss is required.")
+	} else if n := ropts.requiredEssences(); n < 8 {
+		logf("%d essences are required.", n)
+	}
+	if ropts.hints {
+		logf("owl hints on (%s).",
+			ternary(ropts.hintMix == "", defaultHintMix, ropts.hintMix))
+	}
+	if len(ropts.excluded) > 0 {
+		logf("excluding %s.", strings.Join(ropts.excluded, "; "))
+	}
+	if len(ropts.starting) > 0 {
+		logf("starting with %s.", strings.Join(ropts.starting, "; "))
+	}
 }
 
 // attempt to write rom data to a file and print summary info.
 func writeRom(b []byte, dirName, filename, logFilename string, seed uint32,
 	sum []byte, logf logFunc) error {
 	// write file
-	f, err := os.Create(filepath.Join(dirName, filename))
-	if err != nil {
-		return err
-	}
-	defer f.Close()
-	if _, err := f.Write(b); err != nil {
-		return err
+	if !flagPatchOnly {
+		f, err := os.Create(filepath.Join(dirName, filename))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if _, err := f.Write(b); err != nil {
+			return err
+		}
 	}
 
 	// print summary
@@ -370,9 +766,12 @@ func writeRom(b []byte, dirName, filename, logFilename string, seed uint32,
 		logf("seed: %08x", seed)
 	}
 	logf("SHA-1 sum: %x", string(sum))
-	logf("wrote new ROM to %s", filename)
+	if !flagPatchOnly {
+		logf("wrote new ROM to %s", filename)
+	}
 	if flagPlan == "" && !flagRace {
-		logf("wrote log file to %s", logFilename)
+		logf("wrote log files to %s and %s", logFilename,
+			logFilename[:len(logFilename)-4]+".json")
 	}
 
 	return nil
@@ -450,58 +849,111 @@ func readGivenRom(filename string) ([]byte, int, error) {
 		return nil, gameNil, err
 	}
 
-	// check file data
-	if !romIsAges(b) && !romIsSeasons(b) {
-		return nil, gameNil,
-			fmt.Errorf("%s is not an oracles ROM", filename)
+	game, err := checkGivenRom(b, filename)
+	if err != nil {
+		return nil, gameNil, err
+	}
+	return b, game, nil
+}
+
+// returns the game of the given rom data, or an error if the data isn't a
+// vanilla US oracles rom. name is used to identify the rom in errors.
+func checkGivenRom(b []byte, name string) (int, error) {
+	if len(b) < 0x150 || (!romIsAges(b) && !romIsSeasons(b)) {
+		return gameNil, fmt.Errorf("%s is not an oracles ROM", name)
 	}
 	if romIsJp(b) {
-		return nil, gameNil,
-			fmt.Errorf("%s is a JP ROM; only US is supported", filename)
+		return gameNil,
+			fmt.Errorf("%s is a JP ROM; only US is supported", name)
 	}
 	if !romIsVanilla(b) {
-		return nil, gameNil,
-			fmt.Errorf("%s is an unrecognized oracles ROM", filename)
+		return gameNil,
+			fmt.Errorf("%s is an unrecognized oracles ROM", name)
 	}
 
-	game := ternary(romIsSeasons(b), gameSeasons, gameAges).(int)
-	return b, game, nil
+	return ternary(romIsSeasons(b), gameSeasons, gameAges).(int), nil
 }
 
 // finds a valid seed/configuration and writes it to the output file.
 func randomizeFile(rom *romState, dirName, outfile string,
 	ropts randomizerOptions, verbose bool, logf logFunc) error {
-	var seed uint32
-	var sum []byte
-	var err error
-	var logFilename string
-
-	if ropts.portals && rom.game == gameAges {
-		return fmt.Errorf("portal randomization does not apply to ages")
+	if err := ropts.validate(rom.game); err != nil {
+		return err
 	}
 
 	// operate on rom data
-	if outfile != "" {
-		logFilename = outfile[:len(outfile)-4] + "_log.txt"
+	var vanilla []byte
+	if flagPatch != "" {
+		vanilla = make([]byte, len(rom.data))
+		copy(vanilla, rom.data)
 	}
-	seed, sum, logFilename, err = randomize(
-		rom, dirName, logFilename, ropts, verbose, logf)
+	out, err := randomize(
+		context.Background(), rom, ropts, verbose, logf)
 	if err != nil {
 		return err
 	}
+	gamePrefix := sora(rom.game, "oos", "ooa")
 	if outfile == "" {
-		gamePrefix := sora(rom.game, "oos", "ooa")
 		outfile = fmt.Sprintf("%srando_%s_%s.gbc",
-			gamePrefix, version, optString(seed, ropts, "-"))
+			gamePrefix, version, optString(out.seed, out.ropts, "-"))
+	}
+
+	// write spoiler log
+	logFilename := outfile[:len(outfile)-4] + "_log.txt"
+	if ropts.plan == nil && !ropts.race {
+		err := ioutil.WriteFile(
+			filepath.Join(dirName, logFilename), out.summary, 0644)
+		if err != nil {
+			return err
+		}
+		err = ioutil.WriteFile(filepath.Join(dirName,
+			logFilename[:len(logFilename)-4]+".json"), out.jsonLog, 0644)
+		if err != nil {
+			return err
+		}
 	}
 
 	// write to file
-	return writeRom(rom.data, dirName, outfile, logFilename, seed, sum, logf)
+	if vanilla != nil {
+		err := writePatches(vanilla, rom.data,
+			filepath.Join(dirName, outfile), flagPatch, logf)
+		if err != nil {
+			return err
+		}
+	}
+	if err := writeRom(rom.data, dirName, outfile, logFilename, out.seed,
+		out.checksum, logf); err != nil {
+		return err
+	}
+	if flagSym {
+		symFilename := outfile[:len(outfile)-4] + ".sym"
+		if err := ioutil.WriteFile(filepath.Join(dirName, symFilename),
+			rom.getSymbols(), 0644); err != nil {
+			return err
+		}
+		logf("wrote symbols to %s", symFilename)
+	}
+	if out.settings != "" && !ropts.race {
+		logf("settings string: %s", out.settings)
+	}
+	return nil
+}
+
+// parses a semicolon-separated list of item or slot names. semicolons are used
+// since some names contain commas.
+func parseNameList(s string) []string {
+	names := make([]string, 0)
+	for _, name := range strings.Split(s, ";") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
 }
 
-// setRandomSeed sets a 32-bit unsigned random seed based on a hexstring, if
-// non-empty, or else the current time, and returns that seed.
-func setRandomSeed(hexString string) (uint32, error) {
+// parseSeed converts a 32-bit hexstring to a seed, if non-empty, or else
+// returns a seed based on the current time.
+func parseSeed(hexString string) (uint32, error) {
 	seed := uint32(time.Now().UnixNano())
 	if hexString != "" {
 		v, err := strconv.ParseUint(
@@ -511,15 +963,54 @@ func setRandomSeed(hexString string) (uint32, error) {
 		}
 		seed = uint32(v)
 	}
-	rand.Seed(int64(seed))
 
 	return seed, nil
 }
 
-// messes up rom data and writes it to a file.
-func randomize(rom *romState, dirName, logFilename string,
-	ropts randomizerOptions, verbose bool,
-	logf logFunc) (uint32, []byte, string, error) {
+// the products of randomize(), other than the modified rom data itself.
+type randomizeOutput struct {
+	seed     uint32
+	checksum []byte
+	settings string            // empty if using a plan
+	summary  []byte            // text of the spoiler log
+	jsonLog  []byte            // json version of the spoiler log
+	ropts    randomizerOptions // as amended by the plan, if any
+}
+
+// returns the placement rules from the -rules flag or the preset, if either
+// is set.
+func getFlagRules(game int) (placementRules, error) {
+	if flagRules != "" {
+		return loadPlacementRules(flagRules, game)
+	} else if presetRules != "" {
+		return parsePlacementRules(presetRules, game)
+	}
+	return nil, nil
+}
+
+// converts the starting items and excluded checks in ropts from the names
+// that users give to the names the randomizer uses, returning an error if an
+// excluded check doesn't exist.
+func (ropts *randomizerOptions) ungetNiceNames(rom *romState) error {
+	starting := make([]string, len(ropts.starting))
+	for i, name := range ropts.starting {
+		starting[i] = ungetNiceName(name, rom.game)
+	}
+	excluded := make([]string, len(ropts.excluded))
+	for i, name := range ropts.excluded {
+		excluded[i] = ungetNiceName(name, rom.game)
+		if _, ok := rom.itemSlots[excluded[i]]; !ok {
+			return fmt.Errorf("no such check: %s", name)
+		}
+	}
+	ropts.starting, ropts.excluded = starting, excluded
+	return nil
+}
+
+// messes up rom data and generates a spoiler log, without writing anything to
+// disk.
+func randomize(ctx context.Context, rom *romState, ropts randomizerOptions,
+	verbose bool, logf logFunc) (*randomizeOutput, error) {
 	// sanity check beforehand
 	if errs := rom.verify(); errs != nil {
 		if verbose {
@@ -527,27 +1018,35 @@ func randomize(rom *romState, dirName, logFilename string,
 				logf(err.Error())
 			}
 		}
-		return 0, nil, "", errs[0]
+		return nil, errs[0]
+	}
+
+	if err := rom.applyAsmPacks(ropts.asmPacks); err != nil {
+		return nil, err
+	}
+	rom.setTreewarp(ropts.treewarp)
+	if err := ropts.ungetNiceNames(rom); err != nil {
+		return nil, err
 	}
 
 	// search for valid configuration
 	var ri *routeInfo
 	if ropts.plan == nil {
 		logf("searching...")
-		seed, err := setRandomSeed(ropts.seed)
+		seed, err := parseSeed(ropts.seed)
 		if err != nil {
-			return 0, nil, "", err
+			return nil, err
 		}
-		ri, err = findRoute(rom, seed, ropts, verbose, logf)
+		ri, err = findRoute(ctx, rom, seed, ropts, verbose, logf)
 		if err != nil {
-			return 0, nil, "", err
+			return nil, err
 		}
 	} else {
 		logf("applying plan...")
 		var err error
-		ri, err = makePlannedRoute(rom, ropts.plan)
+		ri, err = makePlannedRoute(rom, ropts)
 		if err != nil {
-			return 0, nil, "", err
+			return nil, err
 		}
 		if ri.entrances != nil && len(ri.entrances) > 0 {
 			ropts.dungeons = true
@@ -560,34 +1059,57 @@ func randomize(rom *romState, dirName, logFilename string,
 	// configuration found; come up with auxiliary data
 	checks := getChecks(ri.usedItems, ri.usedSlots)
 	spheres, extra := getSpheres(ri.graph, checks)
-	/*
-		owlNames := orderedKeys(getOwlIds(rom.game))
-		owlHinter := newHinter(rom.game)
-		owlHints := owlHinter.generate(ri.src, ri.graph, checks, owlNames)
-		if ropts.plan != nil {
-			if err := planOwlHints(ropts.plan, owlHinter, owlHints); err != nil {
-				return 0, nil, "", err
-			}
+	var owlHints map[string]string
+	if ropts.plan != nil && len(ropts.plan.hints) > 0 {
+		owlHints = make(map[string]string)
+		for owlName := range getOwlIds(rom.game) {
+			owlHints[owlName] = ""
+		}
+		err := planOwlHints(ropts.plan, newHinter(rom.game), owlHints)
+		if err != nil {
+			return nil, err
+		}
+	} else if ropts.hints {
+		mix, err := ropts.getHintMix()
+		if err != nil {
+			return nil, err
 		}
-	*/
+		owlNames := orderedKeys(getOwlIds(rom.game))
+		owlHints = newHinter(rom.game).generate(ri.src, ri.graph, checks,
+			owlNames, mix, rom.treasures)
+	}
 
-	checksum, err := setRomData(rom, ri, nil, ropts, logf, verbose)
+	checksum, err := setRomData(rom, ri, owlHints, ropts, logf, verbose)
 	if err != nil {
-		return 0, nil, "", err
+		return nil, err
+	}
+	var playthrough [][]*node
+	if ropts.playthrough {
+		playthrough = getPlaythrough(ri.graph, checks, rom.treasures)
 	}
 
-	// write spoiler log
-	if ropts.plan == nil && !ropts.race {
-		if logFilename == "" {
-			gamePrefix := sora(rom.game, "oos", "ooa")
-			logFilename = fmt.Sprintf("%srando_%s_%s_log.txt",
-				gamePrefix, version, optString(ri.seed, ropts, "-"))
-		}
-		writeSummary(filepath.Join(dirName, logFilename), checksum,
-			ropts, rom, ri, checks, spheres, extra, nil)
+	summary := new(bytes.Buffer)
+	writeSummary(summary, checksum, ropts, rom, ri, checks, spheres, extra,
+		owlHints, playthrough)
+	jsonLog := new(bytes.Buffer)
+	if err := writeJSONSummary(jsonLog, checksum, ropts, rom, ri, checks,
+		spheres, extra, owlHints, playthrough); err != nil {
+		return nil, err
 	}
 
-	return ri.seed, checksum, logFilename, nil
+	settings := ""
+	if ropts.plan == nil {
+		settings = encodeSettings(rom.game, ri.seed, ropts)
+	}
+
+	return &randomizeOutput{
+		seed:     ri.seed,
+		checksum: checksum,
+		settings: settings,
+		summary:  summary.Bytes(),
+		jsonLog:  jsonLog.Bytes(),
+		ropts:    ropts,
+	}, nil
 }
 
 // mutates the rom data in-place based on the given route. this doesn't write
@@ -616,6 +1138,8 @@ func setRomData(rom *romState, ri *routeInfo, owlHints map[string]string,
 	}
 
 	rom.setAnimal(ri.companion)
+	rom.setStartingItems(ri.starting)
+	rom.setRequiredEssences(ropts.requiredEssences())
 	if owlHints != nil {
 		rom.setOwlData(owlHints)
 	}
@@ -663,7 +1187,12 @@ func optString(seed uint32, ropts randomizerOptions, flagSep string) string {
 		s += fmt.Sprintf("%08x", seed)
 	}
 
-	if ropts.treewarp || ropts.hard || ropts.dungeons || ropts.portals {
+	if ropts.treewarp || ropts.hard || ropts.dungeons || ropts.portals ||
+		ropts.fill == fillAssumed || ropts.keys == keysAnyDungeon ||
+		ropts.keys == keysAnywhere || ropts.maps == mapsAnywhere ||
+		ropts.maps == mapsVanilla || len(ropts.starting) > 0 ||
+		ropts.requiredEssences() < 8 || len(ropts.excluded) > 0 ||
+		len(ropts.placement) > 0 || ropts.hints || len(ropts.tricks) > 0 {
 		// these are in chronological order of introduction, for no particular
 		// reason.
 		s += flagSep
@@ -679,11 +1208,72 @@ func optString(seed uint32, ropts randomizerOptions, flagSep string) string {
 		if ropts.portals {
 			s += "p"
 		}
+		if ropts.fill == fillAssumed {
+			s += "a"
+		}
+		if ropts.keys == keysAnyDungeon {
+			s += "k"
+		} else if ropts.keys == keysAnywhere {
+			s += "w"
+		}
+		if ropts.maps == mapsAnywhere {
+			s += "m"
+		} else if ropts.maps == mapsVanilla {
+			s += "v"
+		}
+		if len(ropts.starting) > 0 {
+			s += "s"
+		}
+		if ropts.bossOnly {
+			s += "b"
+		} else if n := ropts.requiredEssences(); n < 8 {
+			s += fmt.Sprintf("e%d", n)
+		}
+		if len(ropts.excluded) > 0 {
+			s += "x"
+		}
+		if len(ropts.placement) > 0 {
+			s += "r"
+		}
+		if ropts.hints {
+			s += "o"
+		}
+		if len(ropts.tricks) > 0 && !ropts.hard {
+			s += "i"
+		}
+	}
+
+	if ropts.overlay != nil {
+		s += flagSep + "l" + ropts.overlay.shortSum()
 	}
 
 	return s
 }
 
+// the number of characters in a row of the file select screen.
+const fileSelectWidth = 16
+
+// returns the option string for the file select screen. if optString is too
+// long to fit, the flags are replaced by "." and as much of a hash of them as
+// fits, so that the seed and overlay sum are still shown; e.g.
+// "12345678+.3al79f".
+func fileSelectOptString(seed uint32, ropts randomizerOptions) string {
+	s := optString(seed, ropts, "+")
+	if len(s) <= fileSelectWidth {
+		return s
+	}
+
+	overlayPart := ""
+	if ropts.overlay != nil {
+		overlayPart = "l" + ropts.overlay.shortSum()
+	}
+	seedPart := s[:strings.Index(s, "+")]
+	flags := strings.TrimSuffix(s[len(seedPart):], "+"+overlayPart)
+	sum := fmt.Sprintf("%x", sha1.Sum([]byte(flags)))
+	n := fileSelectWidth - len(seedPart) - len("+.") - len(overlayPart)
+	return seedPart + "+." + sum[:n] + overlayPart
+}
+
 // reverseLookup looks up the key for a given map value. If multiple keys are
 // associated with the same value, it will return one of those keys at random.
 func reverseLookup(m, match interface{}) (interface{}, bool) {
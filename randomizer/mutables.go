@@ -52,6 +52,11 @@ func (rom *romState) setAnimal(companion int) {
 		[]byte{byte(0x10*(4-companion) + 3)}
 }
 
+// sets the number of essences needed for the maku seed.
+func (rom *romState) setRequiredEssences(n int) {
+	rom.codeMutables["requiredEssences"].new[0] = byte(n)
+}
+
 // key = area name (as in asm/vars.yaml), id = season index (spring -> winter).
 func (rom *romState) setSeason(key string, id byte) {
 	rom.codeMutables[key].new[0] = id
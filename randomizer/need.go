@@ -0,0 +1,316 @@
+package randomizer
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// implements the need devcmd, which answers whether some nodes are reachable
+// with a given set of items, and if not, which items would make them so.
+
+// stop looking for more sets of needed items after this many are found, or
+// after this many searches, since the number of sets can explode.
+const (
+	maxNeedSets     = 10
+	maxNeedSearches = 200
+)
+
+// a "what do I need?" query. a companion of zero means any companion, and
+// areas missing from the seasons map can have any default season.
+type needQuery struct {
+	game      int
+	targets   []string
+	have      []string // may contain duplicates, for count nodes
+	tricks    []string
+	overlay   *logicOverlay
+	companion int
+	seasons   map[string]string
+}
+
+// parses semicolon-separated lists of target nodes and of owned items and
+// flags. besides item and node names, owned entries can be "companion=<name>"
+// or "<area>=<season>". tricks and the logic overlay are taken from the
+// options.
+func parseNeedQuery(game int, targets, have string,
+	ropts randomizerOptions) (*needQuery, error) {
+	if err := ropts.validate(game); err != nil {
+		return nil, err
+	}
+	q := &needQuery{
+		game:    game,
+		targets: make([]string, 0),
+		have:    make([]string, 0),
+		tricks:  ropts.enabledTricks(game),
+		overlay: ropts.overlay,
+		seasons: make(map[string]string),
+	}
+	nodes := getPrenodes(game, q.overlay)
+
+	for _, name := range parseNameList(targets) {
+		if nodes[name] == nil {
+			name = ungetNiceName(name, game)
+		}
+		if nodes[name] == nil {
+			return nil, fmt.Errorf("no such node: %s", name)
+		}
+		q.targets = append(q.targets, name)
+	}
+	if len(q.targets) == 0 {
+		return nil, fmt.Errorf("no target nodes given")
+	}
+
+	for _, entry := range parseNameList(have) {
+		if kv := strings.SplitN(entry, "=", 2); len(kv) == 2 {
+			k, v := strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])
+			switch {
+			case k == "companion":
+				q.companion = getStringIndex(
+					[]string{"", "ricky", "dimitri", "moosh"}, v)
+				if q.companion < 1 {
+					return nil, fmt.Errorf("invalid companion: %s", v)
+				}
+			case game == gameSeasons &&
+				getStringIndex(seasonAreas, k) != -1:
+				if getStringIndex(seasonsById, v) == -1 {
+					return nil, fmt.Errorf("invalid season: %s", v)
+				}
+				q.seasons[k] = v
+			default:
+				return nil, fmt.Errorf("invalid setting: %s", entry)
+			}
+			continue
+		}
+
+		name := ungetNiceName(entry, game)
+		if nodes[name] == nil && getStringIndex(rings, name) == -1 &&
+			newRomState(nil, game).treasures[name] == nil {
+			return nil, fmt.Errorf("no such item or node: %s", entry)
+		}
+		q.have = append(q.have, name)
+	}
+
+	return q, nil
+}
+
+// the answer to a needQuery. if the targets aren't reachable, sets are the
+// minimal sets of additional items that would make them reachable, smallest
+// first. no sets means that no items would help.
+type needResult struct {
+	reachable bool
+	sets      [][]string
+}
+
+// runs the query on a new graph.
+func (q *needQuery) run() *needResult {
+	rom := newRomState(nil, q.game)
+	g := newRouteGraph(rom, q.overlay)
+	g.track()
+
+	// set up the world as given
+	g.batch(func() {
+		linkTricks(g, q.tricks)
+		for _, c := range []int{ricky, dimitri, moosh} {
+			if q.companion == 0 || q.companion == c {
+				linkAnimalCompanion(g, q.game, c)
+			}
+		}
+		if q.game == gameSeasons {
+			for _, area := range seasonAreas {
+				for _, season := range seasonsById {
+					if s := q.seasons[area]; s != "" && s != season {
+						continue
+					}
+					name := fmt.Sprintf("%s default %s", area, season)
+					if g[name] != nil {
+						g[name].addParent(g["start"])
+					}
+				}
+			}
+			setPortals(nil, g, false)
+		}
+		setDungeonEntrances(nil, g, q.game, false)
+		linkStartingItems(g, q.have)
+	})
+
+	candidates := q.getCandidates(rom, g)
+	satisfied := func(items []string) bool {
+		g.batch(func() { linkStartingItems(g, items) })
+		g.reset()
+		g["start"].explore()
+		ok := true
+		for _, name := range q.targets {
+			ok = ok && g[name].reached
+		}
+		g.batch(func() {
+			for _, name := range items {
+				g[name].removeParent(g["start"])
+			}
+		})
+		return ok
+	}
+
+	if satisfied(nil) {
+		return &needResult{reachable: true}
+	}
+	return &needResult{sets: findNeedSets(candidates, satisfied)}
+}
+
+// returns the items that could be added to the query's owned items, with
+// duplicates for items that appear more than once. only items that are
+// ancestors of the targets are included.
+func (q *needQuery) getCandidates(rom *romState, g graph) []string {
+	counts := make(map[string]int)
+	for slotName, slot := range rom.itemSlots {
+		tName, _ := reverseLookup(rom.treasures, slot.treasure)
+		name := tName.(string)
+		switch {
+		case seedTreeNames[slotName]:
+			continue
+		case strings.HasSuffix(name, " flute"):
+			for i, flute := range []string{
+				"ricky's flute", "dimitri's flute", "moosh's flute"} {
+				if q.companion == 0 || q.companion == i+1 {
+					counts[flute]++
+				}
+			}
+		default:
+			counts[name]++
+		}
+	}
+	for _, names := range [][]string{seedNames, rings} {
+		for _, name := range names {
+			if counts[name] == 0 {
+				counts[name] = 1
+			}
+		}
+	}
+	for _, name := range q.have {
+		counts[name]--
+	}
+
+	ancestors := make(map[*node]bool)
+	queue := make([]*node, 0)
+	for _, name := range q.targets {
+		queue = append(queue, g[name])
+	}
+	for len(queue) > 0 {
+		for _, parent := range queue[0].parents {
+			if !ancestors[parent] {
+				ancestors[parent] = true
+				queue = append(queue, parent)
+			}
+		}
+		queue = queue[1:]
+	}
+
+	candidates := make([]string, 0)
+	for _, name := range orderedKeys(counts) {
+		if n := g[name]; n != nil && ancestors[n] {
+			for i := 0; i < counts[name]; i++ {
+				candidates = append(candidates, name)
+			}
+		}
+	}
+	return candidates
+}
+
+// returns minimal subsets of the candidates for which satisfied returns true,
+// assuming that adding items never makes satisfied false. each set past the
+// single items is found by removing items one at a time from all the
+// candidates. then, to find sets that aren't supersets of that one, the search
+// is repeated with fewer copies of each item in it available.
+func findNeedSets(candidates []string,
+	satisfied func([]string) bool) [][]string {
+	sets := make([][]string, 0)
+	found := make(map[string]bool)
+	searched := make(map[string]bool)
+
+	// items that are enough on their own can't be part of any other minimal
+	// set, so find those first and leave them out of the search.
+	caps := make(map[string]int) // caps on the number of each item
+	for _, name := range candidates {
+		if _, ok := caps[name]; !ok && satisfied([]string{name}) {
+			caps[name] = 0
+			found[name] = true
+			sets = append(sets, []string{name})
+		}
+	}
+	queue := []map[string]int{caps}
+
+	for len(queue) > 0 && len(sets) < maxNeedSets &&
+		len(searched) < maxNeedSearches {
+		caps := queue[0]
+		queue = queue[1:]
+		key := fmt.Sprint(caps) // map keys are printed in order
+		if searched[key] {
+			continue
+		}
+		searched[key] = true
+
+		counts := make(map[string]int)
+		available := make([]string, 0, len(candidates))
+		for _, name := range candidates {
+			if limit, ok := caps[name]; !ok || counts[name] < limit {
+				available = append(available, name)
+				counts[name]++
+			}
+		}
+		if !satisfied(available) {
+			continue
+		}
+
+		// remove items until no more can be removed
+		set := available
+		for i := len(set) - 1; i >= 0; i-- {
+			smaller := make([]string, 0, len(set)-1)
+			smaller = append(append(smaller, set[:i]...), set[i+1:]...)
+			if satisfied(smaller) {
+				set = smaller
+			}
+		}
+		if key := strings.Join(set, ","); !found[key] {
+			found[key] = true
+			sets = append(sets, set)
+		}
+
+		// search for sets with fewer of each of these items
+		setCounts := make(map[string]int)
+		for _, name := range set {
+			setCounts[name]++
+		}
+		for _, name := range orderedKeys(setCounts) {
+			next := make(map[string]int, len(caps)+1)
+			for k, v := range caps {
+				next[k] = v
+			}
+			next[name] = setCounts[name] - 1
+			queue = append(queue, next)
+		}
+	}
+
+	sort.SliceStable(sets, func(i, j int) bool {
+		if len(sets[i]) != len(sets[j]) {
+			return len(sets[i]) < len(sets[j])
+		}
+		return strings.Join(sets[i], ",") < strings.Join(sets[j], ",")
+	})
+	return sets
+}
+
+// formats a set of items, combining duplicates; e.g. "feather + sword x2".
+func formatNeedSet(set []string) string {
+	counts := make(map[string]int)
+	for _, name := range set {
+		counts[name]++
+	}
+	parts := make([]string, 0, len(counts))
+	for _, name := range orderedKeys(counts) {
+		if counts[name] > 1 {
+			parts = append(parts, fmt.Sprintf("%s x%d", name, counts[name]))
+		} else {
+			parts = append(parts, name)
+		}
+	}
+	return strings.Join(parts, " + ")
+}
@@ -0,0 +1,71 @@
+package randomizer
+
+import "testing"
+
+func TestNeed(t *testing.T) {
+	for _, tc := range []struct {
+		targets, have string
+		reachable     bool
+		set, notSet   string // expected and unexpected sets
+	}{
+		{"maku tree", "", false, "sword", ""},
+		{"maku tree", "sword", true, "", ""},
+		{"horon village SW chest", "", false, "dimitri's flute", ""},
+		{"horon village SW chest", "", false, "boomerang x2", ""},
+		{"horon village SW chest", "companion=ricky", false, "bracelet",
+			"dimitri's flute"},
+	} {
+		q, err := parseNeedQuery(gameSeasons, tc.targets, tc.have,
+			randomizerOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := q.run()
+		if r.reachable != tc.reachable {
+			t.Errorf("%s with %q: expected reachable = %v",
+				tc.targets, tc.have, tc.reachable)
+			continue
+		}
+		found := map[string]bool{}
+		for _, set := range r.sets {
+			found[formatNeedSet(set)] = true
+		}
+		if tc.set != "" && !found[tc.set] {
+			t.Errorf("%s with %q: expected %q in %v",
+				tc.targets, tc.have, tc.set, r.sets)
+		}
+		if tc.notSet != "" && found[tc.notSet] {
+			t.Errorf("%s with %q: unexpected %q in %v",
+				tc.targets, tc.have, tc.notSet, r.sets)
+		}
+	}
+
+	// a trick allows digging up rupees instead of finding them
+	for _, hard := range []bool{false, true} {
+		q, err := parseNeedQuery(gameSeasons, "shop, 150 rupees", "",
+			randomizerOptions{hard: hard})
+		if err != nil {
+			t.Fatal(err)
+		}
+		found := false
+		for _, set := range q.run().sets {
+			found = found || formatNeedSet(set) == "shovel"
+		}
+		if found != hard {
+			t.Errorf("shovel as a set with hard = %v: %v", hard, found)
+		}
+	}
+
+	for _, have := range []string{"companion=ostrich",
+		"north horon=monsoon", "no such item"} {
+		if _, err := parseNeedQuery(gameSeasons, "maku tree", have,
+			randomizerOptions{}); err == nil {
+			t.Errorf("expected error for %q", have)
+		}
+	}
+
+	if got := formatNeedSet([]string{"sword", "feather", "sword"}); got !=
+		"feather + sword x2" {
+		t.Errorf("formatNeedSet gave %q", got)
+	}
+}
@@ -0,0 +1,176 @@
+package randomizer
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"sync"
+
+	"gopkg.in/yaml.v2"
+)
+
+// implements the -logic-overlay option, which changes the logic for house
+// rules without editing the logic files. an overlay is a yaml file like:
+//
+//   add:
+//     new node: [existing node, sword]
+//   replace:
+//     existing node: {or: [feather, cape]}
+//   remove: [some other node]
+//
+// node definitions are in the same format as the logic files. the overlay is
+// applied after the logic files are merged and before nested nodes are
+// flattened.
+
+// a logic overlay, which is parsed separately for each game it's applied to.
+type logicOverlay struct {
+	filename string
+	source   []byte
+	sum      [sha1.Size]byte
+
+	mu       sync.Mutex
+	prenodes map[int]map[string]*prenode
+}
+
+// the sections of an overlay file.
+type overlaySections struct {
+	Add     map[string]interface{}
+	Replace map[string]interface{}
+	Remove  []string
+}
+
+// returns a new logic overlay from the contents of a file. filename is only
+// used in errors.
+func newLogicOverlay(filename string, source []byte) (*logicOverlay, error) {
+	o := &logicOverlay{
+		filename: filename,
+		source:   source,
+		sum:      sha1.Sum(source),
+		prenodes: make(map[int]map[string]*prenode),
+	}
+	var sections overlaySections
+	if err := yaml.UnmarshalStrict(source, &sections); err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	return o, nil
+}
+
+// returns the first three hex digits of the overlay's sha-1 sum, which is
+// enough to tell overlays apart on the file select screen.
+func (o *logicOverlay) shortSum() string {
+	return fmt.Sprintf("%x", o.sum[:2])[:3]
+}
+
+// returns the overlaid logic for a game, loading it the first time.
+func (o *logicOverlay) load(game int) (map[string]*prenode, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.prenodes[game] == nil {
+		nodes, err := loadGameLogic(game, o)
+		if err != nil {
+			return nil, err
+		}
+		o.prenodes[game] = nodes
+	}
+	return o.prenodes[game], nil
+}
+
+// adds, replaces, and removes nodes in the map. the map should contain the
+// logic for the given game, not yet flattened. references to nodes that don't
+// exist are errors if they involve the overlay.
+func (o *logicOverlay) apply(nodes map[string]*prenode, game int) error {
+	var sections overlaySections
+	if err := yaml.UnmarshalStrict(o.source, &sections); err != nil {
+		return fmt.Errorf("%s: %v", o.filename, err)
+	}
+
+	changed := make(map[string]bool)
+	for _, section := range []struct {
+		name   string
+		m      map[string]interface{}
+		exists bool
+	}{
+		{"add", sections.Add, false},
+		{"replace", sections.Replace, true},
+	} {
+		for _, key := range orderedKeys(section.m) {
+			if _, ok := nodes[key]; ok != section.exists {
+				if ok {
+					return fmt.Errorf("%s: add: %s: duplicate logic key",
+						o.filename, key)
+				}
+				return fmt.Errorf("%s: replace: %s: no such logic key",
+					o.filename, key)
+			}
+			pn, err := loadNode(section.m[key])
+			if err != nil {
+				return fmt.Errorf("%s: %s: %s: %v",
+					o.filename, section.name, key, err)
+			}
+			nodes[key] = pn
+			changed[key] = true
+		}
+	}
+
+	rom := newRomState(nil, game)
+	removed := make(map[string]bool)
+	codeLinked := getCodeLinkedNodes(game)
+	for _, key := range sections.Remove {
+		if _, ok := nodes[key]; !ok {
+			return fmt.Errorf("%s: remove: %s: no such logic key",
+				o.filename, key)
+		} else if rom.itemSlots[key] != nil {
+			return fmt.Errorf("%s: remove: %s: can't remove item slot",
+				o.filename, key)
+		} else if codeLinked[key] {
+			return fmt.Errorf("%s: remove: %s: can't remove node used by "+
+				"the randomizer", o.filename, key)
+		}
+		delete(nodes, key)
+		removed[key] = true
+	}
+
+	// item nodes aren't in the logic files, but can be referenced
+	items := make(map[string]bool)
+	for _, slot := range rom.itemSlots {
+		tName, _ := reverseLookup(rom.treasures, slot.treasure)
+		items[tName.(string)] = true
+	}
+	exists := func(name string) bool {
+		_, ok := nodes[name]
+		return ok || items[name]
+	}
+	for _, key := range orderedKeys(nodes) {
+		var err error
+		var check func(pn *prenode)
+		check = func(pn *prenode) {
+			for _, parent := range pn.parents {
+				switch parent := parent.(type) {
+				case string:
+					if err == nil && (removed[parent] ||
+						(changed[key] && !exists(parent))) {
+						err = fmt.Errorf(
+							"%s: %s: reference to nonexistent node %q",
+							o.filename, key, parent)
+					}
+				case *prenode:
+					check(parent)
+				}
+			}
+		}
+		if check(nodes[key]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// returns the overlay's sha-1 sum in hex, or an empty string if the overlay
+// is nil.
+func (o *logicOverlay) sumString() string {
+	if o == nil {
+		return ""
+	}
+	return fmt.Sprintf("%x", o.sum)
+}
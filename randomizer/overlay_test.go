@@ -0,0 +1,69 @@
+package randomizer
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLogicOverlay(t *testing.T) {
+	o, err := newLogicOverlay("test.yaml", []byte(`
+add:
+    test node: [sword, feather]
+replace:
+    hard: {or: [start]}
+remove: [any satchel]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := (randomizerOptions{overlay: o}).validate(gameSeasons); err != nil {
+		t.Fatal(err)
+	}
+	nodes := getPrenodes(gameSeasons, o)
+	if nodes["test node"] == nil {
+		t.Error("added node missing")
+	}
+	if len(nodes["hard"].parents) != 1 {
+		t.Error("replaced node unchanged")
+	}
+	if nodes["any satchel"] != nil {
+		t.Error("removed node still present")
+	}
+	if getPrenodes(gameSeasons, nil)["test node"] != nil {
+		t.Error("overlay changed base logic")
+	}
+
+	s := optString(0, randomizerOptions{overlay: o}, "-")
+	if !strings.HasSuffix(s, "-l"+o.shortSum()) {
+		t.Errorf("overlay missing from opt string: %s", s)
+	}
+
+	for source, want := range map[string]string{
+		"add: {hard: [start]}":                 "duplicate logic key",
+		"replace: {no node: [start]}":          "no such logic key",
+		"remove: [bomb jump 2]":                "reference to nonexistent node",
+		"add: {test node: [no node]}":          "reference to nonexistent node",
+		"remove: [d1 stalfos drop]":            "can't remove item slot",
+		"remove: [start]":                      "can't remove node used",
+		"remove: [spool swamp default winter]": "can't remove node used",
+		"bogus: []":                            "field bogus not found",
+	} {
+		o, err := newLogicOverlay("bad.yaml", []byte(source))
+		if err == nil {
+			_, err = o.load(gameSeasons)
+		}
+		if err == nil || !strings.HasPrefix(err.Error(), "bad.yaml: ") ||
+			!strings.Contains(err.Error(), want) {
+			t.Errorf("%q: got error %v, want %q", source, err, want)
+		}
+	}
+	// nodes that only code links to
+	o, err = newLogicOverlay("bad.yaml", []byte("remove: [dimitri nuun]"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := o.load(gameAges); err == nil ||
+		!strings.Contains(err.Error(), "can't remove node used") {
+		t.Errorf("got error %v for removing companion region", err)
+	}
+}
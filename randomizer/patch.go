@@ -0,0 +1,334 @@
+package randomizer
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// patch formats for the -patch flag.
+const (
+	patchBPS  = "bps"
+	patchIPS  = "ips"
+	patchBoth = "both"
+)
+
+var patchFormats = []string{patchBPS, patchIPS, patchBoth}
+
+// bps patches made by the randomizer have metadata in this format, so that
+// apply can check the vanilla ROM and the result.
+const bpsMetadataFormat = "source sha-1: %x\ntarget sha-1: %x\n"
+
+// returns a bps patch that turns src into dst.
+func makeBPS(src, dst []byte) []byte {
+	b := new(bytes.Buffer)
+	b.WriteString("BPS1")
+	writeBPSNumber(b, uint64(len(src)))
+	writeBPSNumber(b, uint64(len(dst)))
+	metadata := fmt.Sprintf(bpsMetadataFormat, sha1.Sum(src), sha1.Sum(dst))
+	writeBPSNumber(b, uint64(len(metadata)))
+	b.WriteString(metadata)
+
+	// only SourceRead and TargetRead are used, since ROM data doesn't move
+	// around.
+	for i := 0; i < len(dst); {
+		j := i
+		if i < len(src) && src[i] == dst[i] {
+			for j < len(dst) && j < len(src) && src[j] == dst[j] {
+				j++
+			}
+			writeBPSNumber(b, uint64(j-i-1)<<2|0)
+		} else {
+			for j < len(dst) && (j >= len(src) || src[j] != dst[j]) {
+				j++
+			}
+			writeBPSNumber(b, uint64(j-i-1)<<2|1)
+			b.Write(dst[i:j])
+		}
+		i = j
+	}
+
+	binary.Write(b, binary.LittleEndian, crc32.ChecksumIEEE(src))
+	binary.Write(b, binary.LittleEndian, crc32.ChecksumIEEE(dst))
+	binary.Write(b, binary.LittleEndian, crc32.ChecksumIEEE(b.Bytes()))
+	return b.Bytes()
+}
+
+func writeBPSNumber(b *bytes.Buffer, n uint64) {
+	for {
+		x := byte(n & 0x7f)
+		n >>= 7
+		if n == 0 {
+			b.WriteByte(0x80 | x)
+			return
+		}
+		b.WriteByte(x)
+		n--
+	}
+}
+
+// the largest output that a bps patch can have. this is much larger than
+// either ROM, and keeps a bad patch header from allocating too much memory.
+const maxBPSTargetSize = 8 << 20
+
+// applies a bps patch to src, returning the result and the patch metadata.
+func applyBPS(patch, src []byte) ([]byte, string, error) {
+	invalid := fmt.Errorf("invalid bps patch")
+	if len(patch) < 16 || string(patch[:4]) != "BPS1" {
+		return nil, "", invalid
+	}
+	footer := patch[len(patch)-12:]
+	if crc32.ChecksumIEEE(patch[:len(patch)-4]) !=
+		binary.LittleEndian.Uint32(footer[8:]) {
+		return nil, "", fmt.Errorf("bps patch is corrupt")
+	}
+	if crc32.ChecksumIEEE(src) != binary.LittleEndian.Uint32(footer) {
+		return nil, "", fmt.Errorf("patch is for a different ROM")
+	}
+
+	r := &bpsReader{b: patch[:len(patch)-12], i: 4}
+	srcSize, dstSize := r.number(), r.number()
+	metadata := string(r.bytes(r.number()))
+	if r.err != nil || srcSize != uint64(len(src)) {
+		return nil, "", invalid
+	}
+	if dstSize > maxBPSTargetSize {
+		return nil, "", fmt.Errorf("bps patch output is too large")
+	}
+
+	dst := make([]byte, 0, dstSize)
+	var srcRel, dstRel int64
+	for r.err == nil && r.i < len(r.b) {
+		data := r.number()
+		if data>>2 >= dstSize-uint64(len(dst)) {
+			return nil, "", invalid
+		}
+		n := int(data>>2) + 1
+		switch data & 3 {
+		case 0: // SourceRead
+			if len(dst)+n > len(src) {
+				return nil, "", invalid
+			}
+			dst = append(dst, src[len(dst):len(dst)+n]...)
+		case 1: // TargetRead
+			dst = append(dst, r.bytes(uint64(n))...)
+		case 2: // SourceCopy
+			srcRel += r.offset()
+			if srcRel < 0 || srcRel+int64(n) > int64(len(src)) {
+				return nil, "", invalid
+			}
+			dst = append(dst, src[srcRel:srcRel+int64(n)]...)
+			srcRel += int64(n)
+		case 3: // TargetCopy, which can overlap itself
+			dstRel += r.offset()
+			if dstRel < 0 || dstRel >= int64(len(dst)) {
+				return nil, "", invalid
+			}
+			for i := 0; i < n; i++ {
+				dst = append(dst, dst[dstRel])
+				dstRel++
+			}
+		}
+	}
+	if r.err != nil || uint64(len(dst)) != dstSize {
+		return nil, "", invalid
+	}
+	if crc32.ChecksumIEEE(dst) != binary.LittleEndian.Uint32(footer[4:]) {
+		return nil, "", fmt.Errorf("patched ROM has the wrong checksum")
+	}
+
+	return dst, metadata, nil
+}
+
+// reads numbers and data from a bps patch, remembering the first error.
+type bpsReader struct {
+	b   []byte
+	i   int
+	err error
+}
+
+func (r *bpsReader) number() uint64 {
+	var n, shift uint64 = 0, 1
+	for r.err == nil {
+		if r.i >= len(r.b) || shift > 1<<56 {
+			r.err = fmt.Errorf("invalid bps patch")
+			return 0
+		}
+		x := uint64(r.b[r.i])
+		r.i++
+		n += (x & 0x7f) * shift
+		if x&0x80 != 0 {
+			break
+		}
+		shift <<= 7
+		n += shift
+	}
+	return n
+}
+
+func (r *bpsReader) offset() int64 {
+	n := r.number()
+	return ternary(n&1 != 0, -int64(n>>1), int64(n>>1)).(int64)
+}
+
+func (r *bpsReader) bytes(n uint64) []byte {
+	if r.err != nil || n > uint64(len(r.b)-r.i) {
+		r.err = fmt.Errorf("invalid bps patch")
+		return nil
+	}
+	b := r.b[r.i : r.i+int(n)]
+	r.i += int(n)
+	return b
+}
+
+// returns an ips patch that turns src into dst. dst can't be shorter than
+// src.
+func makeIPS(src, dst []byte) []byte {
+	b := new(bytes.Buffer)
+	b.WriteString("PATCH")
+
+	for i := 0; i < len(dst); {
+		if i < len(src) && src[i] == dst[i] {
+			i++
+			continue
+		}
+		// an offset that spells "EOF" would end the patch early
+		if i == 0x454f46 {
+			i--
+		}
+		j := i
+		for j < len(dst) && j-i < 0xffff &&
+			(j >= len(src) || src[j] != dst[j] || j == i) {
+			j++
+		}
+		b.Write([]byte{byte(i >> 16), byte(i >> 8), byte(i)})
+		b.Write([]byte{byte((j - i) >> 8), byte(j - i)})
+		b.Write(dst[i:j])
+		i = j
+	}
+
+	b.WriteString("EOF")
+	return b.Bytes()
+}
+
+// applies an ips patch to src and returns the result.
+func applyIPS(patch, src []byte) ([]byte, error) {
+	invalid := fmt.Errorf("invalid ips patch")
+	if len(patch) < 8 || string(patch[:5]) != "PATCH" {
+		return nil, invalid
+	}
+
+	dst := make([]byte, len(src))
+	copy(dst, src)
+	for i := 5; ; {
+		if i+3 > len(patch) {
+			return nil, invalid
+		}
+		if string(patch[i:i+3]) == "EOF" {
+			break
+		}
+		if i+5 > len(patch) {
+			return nil, invalid
+		}
+		offset := int(patch[i])<<16 | int(patch[i+1])<<8 | int(patch[i+2])
+		size := int(patch[i+3])<<8 | int(patch[i+4])
+		i += 5
+
+		var data []byte
+		if size == 0 { // run-length encoded
+			if i+3 > len(patch) {
+				return nil, invalid
+			}
+			size = int(patch[i])<<8 | int(patch[i+1])
+			data = bytes.Repeat(patch[i+2:i+3], size)
+			i += 3
+		} else {
+			if i+size > len(patch) {
+				return nil, invalid
+			}
+			data = patch[i : i+size]
+			i += size
+		}
+
+		for len(dst) < offset+size {
+			dst = append(dst, 0)
+		}
+		copy(dst[offset:], data)
+	}
+
+	return dst, nil
+}
+
+// writes patches in the given format(s) for the randomized ROM, using the
+// same base filename as the ROM.
+func writePatches(vanilla, randomized []byte, path, format string,
+	logf logFunc) error {
+	base := strings.TrimSuffix(path, ".gbc")
+	if format == patchBPS || format == patchBoth {
+		if err := ioutil.WriteFile(
+			base+".bps", makeBPS(vanilla, randomized), 0644); err != nil {
+			return err
+		}
+		logf("wrote patch to %s", base+".bps")
+	}
+	if format == patchIPS || format == patchBoth {
+		if err := ioutil.WriteFile(
+			base+".ips", makeIPS(vanilla, randomized), 0644); err != nil {
+			return err
+		}
+		logf("wrote patch to %s", base+".ips")
+	}
+	return nil
+}
+
+// implements the apply subcommand: patches a vanilla ROM and writes the result
+// to a file. bps patches from the randomizer are checked against the SHA-1
+// sums in their metadata.
+func applyPatchFile(patchPath, romPath, outPath string, logf logFunc) error {
+	patch, err := ioutil.ReadFile(patchPath)
+	if err != nil {
+		return err
+	}
+	src, _, err := readGivenRom(romPath)
+	if err != nil {
+		return err
+	}
+
+	var dst []byte
+	if bytes.HasPrefix(patch, []byte("BPS1")) {
+		var metadata string
+		dst, metadata, err = applyBPS(patch, src)
+		if err != nil {
+			return err
+		}
+		// patches from elsewhere may have other metadata, or none
+		srcSum := fmt.Sprintf("source sha-1: %x\n", sha1.Sum(src))
+		if strings.HasPrefix(metadata, "source sha-1: ") {
+			if !strings.HasPrefix(metadata, srcSum) {
+				return fmt.Errorf("vanilla ROM doesn't match patch")
+			}
+			if metadata != fmt.Sprintf(bpsMetadataFormat,
+				sha1.Sum(src), sha1.Sum(dst)) {
+				return fmt.Errorf("patched ROM has the wrong SHA-1 sum")
+			}
+		}
+	} else if dst, err = applyIPS(patch, src); err != nil {
+		return err
+	}
+
+	if outPath == "" {
+		outPath = strings.TrimSuffix(patchPath, filepath.Ext(patchPath)) +
+			".gbc"
+	}
+	if err := ioutil.WriteFile(outPath, dst, 0644); err != nil {
+		return err
+	}
+	logf("SHA-1 sum: %x", sha1.Sum(dst))
+	logf("wrote patched ROM to %s", outPath)
+	return nil
+}
@@ -0,0 +1,61 @@
+package randomizer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"math/rand"
+	"testing"
+)
+
+func TestPatches(t *testing.T) {
+	src := make([]byte, 0x460000)
+	rand.New(rand.NewSource(1)).Read(src)
+	dst := make([]byte, len(src)+0x100)
+	copy(dst, src)
+	// 0x454f46 spells "EOF" in ips offsets
+	for _, i := range []int{0, 1, 2, 0x1000, 0x454f46, len(src) - 1} {
+		dst[i]++
+	}
+	for i := 0x2000; i < 0x30000; i++ {
+		dst[i] = 0
+	}
+
+	patch := makeBPS(src, dst)
+	b, _, err := applyBPS(patch, src)
+	if err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(b, dst) {
+		t.Error("bps patch gave wrong result")
+	}
+	if _, _, err := applyBPS(patch, dst); err == nil {
+		t.Error("bps patch applied to wrong ROM")
+	}
+	patch[len(patch)/2]++
+	if _, _, err := applyBPS(patch, src); err == nil {
+		t.Error("corrupt bps patch applied")
+	}
+
+	// header claims a huge output size
+	huge := new(bytes.Buffer)
+	huge.WriteString("BPS1")
+	writeBPSNumber(huge, uint64(len(src)))
+	writeBPSNumber(huge, 1<<40)
+	writeBPSNumber(huge, 0)
+	binary.Write(huge, binary.LittleEndian, crc32.ChecksumIEEE(src))
+	binary.Write(huge, binary.LittleEndian, uint32(0))
+	binary.Write(huge, binary.LittleEndian, crc32.ChecksumIEEE(huge.Bytes()))
+	if _, _, err := applyBPS(huge.Bytes(), src); err == nil {
+		t.Error("bps patch with huge output size applied")
+	}
+
+	b, err = applyIPS(makeIPS(src, dst), src)
+	if err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(b, dst) {
+		t.Error("ips patch gave wrong result")
+	}
+	if _, err := applyIPS([]byte("PATCH\x00\x00"), src); err == nil {
+		t.Error("truncated ips patch applied")
+	}
+}
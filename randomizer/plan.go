@@ -20,6 +20,7 @@ type plan struct {
 	portals  map[string]string
 	seasons  map[string]string
 	hints    map[string]string
+	starting []string
 }
 
 func newPlan() *plan {
@@ -29,6 +30,7 @@ func newPlan() *plan {
 		portals:  make(map[string]string),
 		seasons:  make(map[string]string),
 		hints:    make(map[string]string),
+		starting: make([]string, 0),
 	}
 }
 
@@ -47,12 +49,19 @@ func parseSummary(path string, game int) (*plan, error) {
 		return nil, err
 	}
 
+	return parsePlan(string(b), game)
+}
+
+// loads conditions from a string in spoiler log format.
+func parsePlan(source string, game int) (*plan, error) {
 	p := newPlan()
-	p.source = string(b)
+	p.source = source
 	section := p.items
-	for _, line := range strings.Split(string(b), "\n") {
+	starting := false
+	for _, line := range strings.Split(source, "\n") {
 		line = strings.Replace(line, "\r", "", 1)
 		if strings.HasPrefix(line, "--") {
+			starting = line == "-- starting items --"
 			switch line {
 			case "-- items --", "-- progression items --",
 				"-- small keys and boss keys --", "-- other items --":
@@ -65,9 +74,18 @@ func parseSummary(path string, game int) (*plan, error) {
 				section = p.seasons
 			case "-- hints --":
 				section = p.hints
+			case "-- starting items --":
+				section = nil
+			case "-- excluded locations --", "-- playthrough --":
+				// only matters for random placement
+				section = make(map[string]string)
 			default:
 				return nil, fmt.Errorf("unknown section: %q", line)
 			}
+		} else if starting {
+			if line = strings.TrimSpace(line); line != "" {
+				p.starting = append(p.starting, ungetNiceName(line, game))
+			}
 		} else {
 			submatches := conditionRegexp.FindStringSubmatch(line)
 			if submatches != nil {
@@ -92,14 +110,24 @@ func parseSummary(path string, game int) (*plan, error) {
 }
 
 // like findRoute, but uses a specified configuration instead of a random one.
-func makePlannedRoute(rom *romState, p *plan) (*routeInfo, error) {
+func makePlannedRoute(
+	rom *romState, ropts randomizerOptions) (*routeInfo, error) {
+	p, rules := ropts.plan, ropts.dungeonItemRules()
 	ri := &routeInfo{
 		companion: sora(rom.game, moosh, dimitri).(int), // shop is default
 		entrances: make(map[string]string),
-		graph:     newRouteGraph(rom),
+		graph:     newRouteGraph(rom, ropts.overlay),
 		src:       rand.New(rand.NewSource(0)),
 		usedItems: list.New(),
 		usedSlots: list.New(),
+		rules:     rules,
+		starting:  p.starting,
+	}
+
+	setRequiredEssences(ri.graph, ropts.requiredEssences())
+
+	if err := validateStartingItems(p.starting, rom.game); err != nil {
+		return nil, err
 	}
 
 	// must init rings before item placement
@@ -130,7 +158,7 @@ func makePlannedRoute(rom *romState, p *plan) (*routeInfo, error) {
 			return nil, fmt.Errorf("no such check: %s", slot)
 		}
 		ri.graph[item] = newNode(item, orNode)
-		if !itemFitsInSlot(ri.graph[item], ri.graph[slot]) {
+		if !itemFitsInSlot(ri.graph[item], ri.graph[slot], rules) {
 			return nil, fmt.Errorf("%s doesn't fit in %s", item, slot)
 		}
 		ri.graph[item].addParent(ri.graph[slot])
@@ -199,6 +227,8 @@ func makePlannedRoute(rom *romState, p *plan) (*routeInfo, error) {
 		return nil, fmt.Errorf("ages doesn't have subrosia portals")
 	}
 
+	linkStartingItems(ri.graph, ri.starting)
+
 	return ri, nil
 }
 
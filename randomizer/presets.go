@@ -0,0 +1,131 @@
+package randomizer
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// implements the -preset flag. presets are yaml maps of flag names to values,
+// like:
+//
+//   treewarp: true
+//   keysanity: dungeons
+//   start: [feather, bracelet]
+//   rules:
+//     sword: {not in: [dungeons]}
+//
+// lists are joined with semicolons, and rules can be given inline instead of
+// as a path. built-in presets are in the presets/ directory.
+
+// flags that aren't randomizer options and can't be set by presets.
+var nonPresetFlags = map[string]bool{
+	"cpuprofile": true,
+	"datadir":    true,
+	"devcmd":     true,
+	"noui":       true,
+	"patch":      true,
+	"patchonly":  true,
+	"plan":       true,
+	"preset":     true,
+	"seed":       true,
+	"settings":   true,
+	"sym":        true,
+	"verbose":    true,
+	"workers":    true,
+}
+
+// placement rules given inline in a preset, in yaml.
+var presetRules string
+
+// returns the names of the built-in presets.
+func getPresetNames() []string {
+	dir, err := FS(false).Open("/presets")
+	if err != nil {
+		panic(err)
+	}
+	defer dir.Close()
+	infos, err := dir.Readdir(-1)
+	if err != nil {
+		panic(err)
+	}
+
+	names := make([]string, 0, len(infos))
+	for _, info := range infos {
+		if strings.HasSuffix(info.Name(), ".yaml") {
+			names = append(names, strings.TrimSuffix(info.Name(), ".yaml"))
+		}
+	}
+	return names
+}
+
+// loads a preset by built-in name or filename.
+func loadPreset(name string) ([]byte, error) {
+	if getStringIndex(getPresetNames(), name) != -1 {
+		return FSByte(false, "/presets/"+name+".yaml")
+	}
+	return ioutil.ReadFile(name)
+}
+
+// sets flags from a preset, except for flags that were given explicitly on
+// the command line.
+func applyPreset(fs *flag.FlagSet, source []byte) error {
+	raw := make(map[string]interface{})
+	if err := yaml.UnmarshalStrict(source, raw); err != nil {
+		return err
+	}
+
+	explicit := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+
+	for _, key := range orderedKeys(raw) {
+		f := fs.Lookup(key)
+		if f == nil || nonPresetFlags[key] {
+			return fmt.Errorf("unknown option in preset: %s", key)
+		}
+		if explicit[key] {
+			continue
+		}
+
+		var s string
+		switch v := raw[key].(type) {
+		case []interface{}:
+			names := make([]string, len(v))
+			for i, name := range v {
+				names[i] = fmt.Sprint(name)
+			}
+			s = strings.Join(names, ";")
+		case map[interface{}]interface{}:
+			if key != "rules" {
+				return fmt.Errorf("invalid value for %s in preset", key)
+			}
+			b, err := yaml.Marshal(v)
+			if err != nil {
+				return err
+			}
+			presetRules = string(b)
+			continue
+		case bool:
+			// yaml reads unquoted "off" as false
+			if bf, ok := f.Value.(interface{ IsBoolFlag() bool }); ok &&
+				bf.IsBoolFlag() {
+				s = fmt.Sprint(v)
+			} else {
+				s = ternary(v, "on", "off").(string)
+			}
+		default:
+			s = fmt.Sprint(v)
+		}
+
+		if err := f.Value.Set(s); err != nil {
+			return fmt.Errorf("invalid value for %s in preset: %v", key, err)
+		}
+	}
+
+	return nil
+}
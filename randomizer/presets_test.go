@@ -0,0 +1,62 @@
+package randomizer
+
+import (
+	"flag"
+	"testing"
+)
+
+func TestPresets(t *testing.T) {
+	for _, name := range getPresetNames() {
+		source, err := loadPreset(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fs := flag.NewFlagSet(name, flag.ContinueOnError)
+		defineFlags(fs)
+		if err := applyPreset(fs, source); err != nil {
+			t.Errorf("preset %s: %v", name, err)
+		}
+	}
+	if len(getPresetNames()) != 3 {
+		t.Errorf("expected 3 built-in presets, got %v", getPresetNames())
+	}
+
+	// explicit flags override the preset, and unknown or invalid options are
+	// errors.
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	defineFlags(fs)
+	if err := fs.Parse([]string{"-keysanity", "anywhere"}); err != nil {
+		t.Fatal(err)
+	}
+	err := applyPreset(fs, []byte(
+		"keysanity: off\nmaps: anywhere\nstart: [feather, bracelet]\nessences: 5"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if flagKeys != keysAnywhere || flagMaps != mapsAnywhere ||
+		flagStart != "feather;bracelet" || flagEssences != 5 {
+		t.Errorf("preset applied wrong: %q, %q, %q, %d",
+			flagKeys, flagMaps, flagStart, flagEssences)
+	}
+	for _, source := range []string{
+		"seed: 1234abcd",
+		"not a flag: true",
+		"essences: lots",
+		"start: {feather: bracelet}",
+	} {
+		if err := applyPreset(fs, []byte(source)); err == nil {
+			t.Errorf("invalid preset accepted: %q", source)
+		}
+	}
+
+	// options that don't make sense together are caught before a game is
+	// known.
+	if err := (randomizerOptions{bossOnly: true, essences: 3}).validate(
+		gameNil); err == nil {
+		t.Error("essences accepted with boss only")
+	}
+	if err := (randomizerOptions{portals: true}).validate(
+		gameAges); err == nil {
+		t.Error("portals accepted for ages")
+	}
+}
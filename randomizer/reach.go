@@ -0,0 +1,317 @@
+package randomizer
+
+import (
+	"fmt"
+	"sort"
+)
+
+// a reachState incrementally tracks which nodes of a graph are reachable.
+// nodes are identified by integer IDs, and reachability is stored as a
+// bitset. adding or removing a single parent link updates only the part of
+// the graph that depends on that link, instead of resetting and exploring the
+// whole graph.
+//
+// removals use the "delete and rederive" method: every node that might have
+// depended on the removed link is marked unreached, then any of those nodes
+// that are still reachable by other means are re-marked.
+type reachState struct {
+	nodes    []*node
+	parents  [][]int // may contain duplicates, like node.parents
+	children [][]int
+	links    []int    // number of reached parent links for each node
+	rupees   []int    // rupee value of each node, from rupeeValues
+	reached  []uint64 // bitset
+	queue    []int
+
+	// count nodes that depend on the number of reached links of each node.
+	// these only change if links to count or rupees nodes change.
+	deps      [][]int
+	depsStale bool
+
+	// if batching, link changes only update the adjacency lists, and
+	// reachability is recalculated from scratch when the batch ends.
+	batching, dirty bool
+}
+
+// track makes the graph's reachability update incrementally whenever a link
+// between its nodes changes. after this, graph.reset() and node.explore() are
+// no-ops, since the nodes' reached fields are always current.
+func (g graph) track() {
+	names := make([]string, 0, len(g))
+	for name := range g {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	rs := &reachState{
+		nodes:    make([]*node, len(names)),
+		parents:  make([][]int, len(names)),
+		children: make([][]int, len(names)),
+		links:    make([]int, len(names)),
+		rupees:   make([]int, len(names)),
+		reached:  make([]uint64, (len(names)+63)/64),
+	}
+	for i, name := range names {
+		n := g[name]
+		n.id, n.rs = i, rs
+		rs.nodes[i] = n
+		rs.rupees[i] = rupeeValues[name]
+	}
+	for i, n := range rs.nodes {
+		rs.parents[i] = make([]int, len(n.parents))
+		for j, p := range n.parents {
+			rs.parents[i][j] = rs.idOf(p)
+		}
+		rs.children[i] = make([]int, len(n.children))
+		for j, c := range n.children {
+			rs.children[i][j] = rs.idOf(c)
+		}
+	}
+
+	rs.depsStale = true
+	rs.recalculate()
+}
+
+// returns the graph's reachState, or nil if the graph isn't tracked.
+func (g graph) reachState() *reachState {
+	if start := g["start"]; start != nil {
+		return start.rs
+	}
+	return nil
+}
+
+// runs f, which may change many links in the graph, and updates reachability
+// once afterward instead of after each change.
+func (g graph) batch(f func()) {
+	rs := g.reachState()
+	if rs == nil || rs.batching {
+		f()
+		return
+	}
+
+	rs.batching = true
+	f()
+	rs.batching = false
+	if rs.dirty {
+		rs.recalculate()
+	}
+}
+
+// returns the ID of a node, panicking if it isn't tracked by rs.
+func (rs *reachState) idOf(n *node) int {
+	if n.rs != rs {
+		panic(fmt.Sprintf("node %s is not tracked with its graph", n.name))
+	}
+	return n.id
+}
+
+func (rs *reachState) isReached(i int) bool {
+	return rs.reached[i/64]&(1<<uint(i%64)) != 0
+}
+
+// sets the bit for a node, and mirrors it to the node itself.
+func (rs *reachState) setReached(i int, v bool) {
+	if v {
+		rs.reached[i/64] |= 1 << uint(i%64)
+	} else {
+		rs.reached[i/64] &^= 1 << uint(i%64)
+	}
+	rs.nodes[i].reached = v
+}
+
+// returns the value that a count node with the given parent compares against
+// its minimum count.
+func (rs *reachState) countValue(p int) int {
+	switch rs.nodes[p].ntype {
+	case rupeesNode:
+		sum := 0
+		for _, pp := range rs.parents[p] {
+			if rs.isReached(pp) {
+				sum += rs.rupees[pp] * rs.multiplicity(pp)
+			}
+		}
+		return sum
+	case orNode:
+		return rs.links[p]
+	default:
+		if rs.isReached(p) {
+			return 1
+		}
+		return 0
+	}
+}
+
+// returns the number of times a rupee source is counted. items count once per
+// slot they're in.
+func (rs *reachState) multiplicity(i int) int {
+	if rs.nodes[i].ntype == orNode {
+		return rs.links[i]
+	}
+	return 1
+}
+
+// returns true iff the node's requirements are met by its reached parents.
+func (rs *reachState) satisfied(i int) bool {
+	n := rs.nodes[i]
+	switch n.ntype {
+	case andNode:
+		return rs.links[i] >= len(rs.parents[i])
+	case orNode, rupeesNode:
+		return rs.links[i] >= 1
+	case countNode:
+		if len(rs.parents[i]) == 0 {
+			return n.minCount <= 0
+		}
+		return rs.countValue(rs.parents[i][0]) >= n.minCount
+	default:
+		panic("unknown type for node: " + n.name)
+	}
+}
+
+// appends the nodes whose count values depend on the number of reached links
+// of node i to the queue.
+func (rs *reachState) queueDependents(i int) {
+	if rs.depsStale {
+		rs.updateDeps()
+	}
+	rs.queue = append(rs.queue, rs.deps[i]...)
+}
+
+// recalculates the count node dependents of each node.
+func (rs *reachState) updateDeps() {
+	rs.deps = make([][]int, len(rs.nodes))
+	for i := range rs.nodes {
+		for _, c := range rs.children[i] {
+			switch rs.nodes[c].ntype {
+			case countNode:
+				rs.deps[i] = append(rs.deps[i], c)
+			case rupeesNode:
+				for _, cc := range rs.children[c] {
+					if rs.nodes[cc].ntype == countNode {
+						rs.deps[i] = append(rs.deps[i], cc)
+					}
+				}
+			}
+		}
+	}
+	rs.depsStale = false
+}
+
+// marks dependents as needing recalculation if a link to c would change them.
+func (rs *reachState) checkDeps(c int) {
+	switch rs.nodes[c].ntype {
+	case countNode, rupeesNode:
+		rs.depsStale = true
+	}
+}
+
+// marks queued nodes as reached if their requirements are met, and continues
+// on to their children.
+func (rs *reachState) propagate() {
+	for len(rs.queue) > 0 {
+		i := rs.queue[len(rs.queue)-1]
+		rs.queue = rs.queue[:len(rs.queue)-1]
+		if rs.isReached(i) || !rs.satisfied(i) {
+			continue
+		}
+
+		rs.setReached(i, true)
+		for _, c := range rs.children[i] {
+			rs.links[c]++
+			rs.queue = append(rs.queue, c)
+			rs.queueDependents(c)
+		}
+	}
+}
+
+// marks queued nodes and everything reached downstream of them as unreached,
+// then re-marks any of those nodes that are still reachable.
+func (rs *reachState) invalidate() {
+	deleted := make([]int, 0)
+	for len(rs.queue) > 0 {
+		i := rs.queue[len(rs.queue)-1]
+		rs.queue = rs.queue[:len(rs.queue)-1]
+		if !rs.isReached(i) {
+			continue
+		}
+
+		rs.setReached(i, false)
+		deleted = append(deleted, i)
+		for _, c := range rs.children[i] {
+			rs.links[c]--
+			rs.queue = append(rs.queue, c)
+			rs.queueDependents(c)
+		}
+	}
+
+	rs.queue = append(rs.queue, deleted...)
+	rs.propagate()
+}
+
+// recalculates reachability for the whole graph.
+func (rs *reachState) recalculate() {
+	for i := range rs.reached {
+		rs.reached[i] = 0
+	}
+	for i := range rs.nodes {
+		rs.links[i] = 0
+		rs.nodes[i].reached = false
+		rs.queue = append(rs.queue, i)
+	}
+	rs.propagate()
+	rs.dirty = false
+}
+
+// updates reachability after parent p is linked to child c.
+func (rs *reachState) addLink(c, p int) {
+	rs.parents[c] = append(rs.parents[c], p)
+	rs.children[p] = append(rs.children[p], c)
+	rs.checkDeps(c)
+	if rs.batching {
+		rs.dirty = true
+		return
+	}
+
+	if rs.isReached(p) {
+		rs.links[c]++
+		rs.queue = append(rs.queue, c)
+		rs.queueDependents(c)
+		rs.propagate()
+	} else if rs.isReached(c) && !rs.satisfied(c) {
+		// and nodes need every parent
+		rs.queue = append(rs.queue, c)
+		rs.invalidate()
+	}
+}
+
+// updates reachability after parent p is unlinked from child c.
+func (rs *reachState) removeLink(c, p int) {
+	rs.parents[c] = removeInt(rs.parents[c], p)
+	rs.children[p] = removeInt(rs.children[p], c)
+	rs.checkDeps(c)
+	if rs.batching {
+		rs.dirty = true
+		return
+	}
+
+	if rs.isReached(p) {
+		rs.links[c]--
+		rs.queue = append(rs.queue, c)
+		rs.queueDependents(c)
+		rs.invalidate()
+	} else {
+		// an and node may have lost its last missing parent
+		rs.queue = append(rs.queue, c)
+		rs.propagate()
+	}
+}
+
+// removes the first instance of v from a, in place.
+func removeInt(a []int, v int) []int {
+	for i, x := range a {
+		if x == v {
+			return append(a[:i], a[i+1:]...)
+		}
+	}
+	panic(fmt.Sprintf("removeInt: %d not in slice", v))
+}
@@ -0,0 +1,55 @@
+package randomizer
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// make sure that incremental reachability matches a full explore after each
+// link change.
+func TestReachState(t *testing.T) {
+	for _, game := range []int{gameSeasons, gameAges} {
+		rom := newRomState(nil, game)
+		untracked, tracked := newRouteGraph(rom, nil), newRouteGraph(rom, nil)
+		tracked.track()
+
+		// start with every item owned, like findRoute does, then move items
+		// back and forth between the start and random slots.
+		src := rand.New(rand.NewSource(0))
+		slots, items := orderedKeys(rom.itemSlots), orderedKeys(rom.treasures)
+		parents := make(map[string]string)
+		for _, item := range items {
+			if untracked[item] != nil {
+				parents[item] = "start"
+			}
+		}
+		items = orderedKeys(parents)
+		for _, g := range []graph{untracked, tracked} {
+			g.batch(func() {
+				for _, item := range items {
+					g[item].addParent(g["start"])
+				}
+			})
+		}
+
+		for i := 0; i < 1000; i++ {
+			item := items[src.Intn(len(items))]
+			parent := ternary(parents[item] == "start",
+				slots[src.Intn(len(slots))], "start").(string)
+			for _, g := range []graph{untracked, tracked} {
+				g[item].removeParent(g[parents[item]])
+				g[item].addParent(g[parent])
+			}
+			parents[item] = parent
+
+			untracked.reset()
+			untracked["start"].explore()
+			for name, n := range untracked {
+				if tracked[name].reached != n.reached {
+					t.Fatalf("%s: step %d: %s reached: expected %v",
+						gameNames[game], i, name, n.reached)
+				}
+			}
+		}
+	}
+}
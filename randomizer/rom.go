@@ -113,41 +113,22 @@ func (rom *romState) mutate(warpMap map[string]string, seed uint32,
 			[]byte{westernCoastSeason}
 
 		rom.setTreasureMapData()
-
-		// explicitly set these addresses and IDs after their functions
-		codeAddr := rom.codeMutables["setStarOreIds"].addr
-		rom.itemSlots["subrosia seaside"].idAddrs[0].offset = codeAddr.offset + 2
-		rom.itemSlots["subrosia seaside"].subidAddrs[0].offset = codeAddr.offset + 5
-		codeAddr = rom.codeMutables["setHardOreIds"].addr
-		rom.itemSlots["great furnace"].idAddrs[0].offset = codeAddr.offset + 2
-		rom.itemSlots["great furnace"].subidAddrs[0].offset = codeAddr.offset + 5
-		codeAddr = rom.codeMutables["script_diverGiveItem"].addr
-		rom.itemSlots["master diver's reward"].idAddrs[0].offset = codeAddr.offset + 1
-		rom.itemSlots["master diver's reward"].subidAddrs[0].offset = codeAddr.offset + 2
-		codeAddr = rom.codeMutables["createMtCuccoItem"].addr
-		rom.itemSlots["mt. cucco, platform cave"].idAddrs[0].offset = codeAddr.offset + 2
-		rom.itemSlots["mt. cucco, platform cave"].subidAddrs[0].offset = codeAddr.offset + 1
-	} else {
-		// explicitly set these addresses and IDs after their functions
-		mut := rom.codeMutables["script_soldierGiveItem"]
-		slot := rom.itemSlots["deku forest soldier"]
-		slot.idAddrs[0].offset = mut.addr.offset + 13
-		slot.subidAddrs[0].offset = mut.addr.offset + 14
-		mut = rom.codeMutables["script_giveTargetCartsSecondPrize"]
-		codeAddr := mut.addr
-		rom.itemSlots["target carts 2"].idAddrs[1].offset = codeAddr.offset + 1
-		rom.itemSlots["target carts 2"].subidAddrs[1].offset = codeAddr.offset + 2
 	}
 
-	rom.setBossItemAddrs()
+	rom.setCodeSlotAddrs()
 	rom.setSeedData()
 	rom.setRoomTreasureData()
-	rom.setFileSelectText(optString(seed, ropts, "+"))
+	err := rom.setFileSelectText(fileSelectOptString(seed, ropts))
+	if err != nil {
+		return nil, err
+	}
 	rom.attachText()
 
 	// regenerate collect mode table to accommodate changes based on contents.
 	rom.codeMutables["collectModeTable"].new =
 		[]byte(makeCollectModeTable(rom.itemSlots))
+	rom.codeMutables["keyDungeons"].new =
+		[]byte(makeKeyDungeonTable(rom.itemSlots))
 
 	// set the text IDs for all rings to $ff (blank), since custom code deals
 	// with text
@@ -157,7 +138,6 @@ func (rom *romState) mutate(warpMap map[string]string, seed uint32,
 		}
 	}
 
-	var err error
 	mutables := rom.getAllMutables()
 	for _, k := range orderedKeys(mutables) {
 		err = mutables[k].mutate(rom.data)
@@ -202,6 +182,36 @@ func (rom *romState) mutate(warpMap map[string]string, seed uint32,
 	return outSum[:], nil
 }
 
+// sets the addresses of slots whose data is in randomizer code, since they
+// aren't known until the asm is assembled.
+func (rom *romState) setCodeSlotAddrs() {
+	if rom.game == gameSeasons {
+		codeAddr := rom.codeMutables["setStarOreIds"].addr
+		rom.itemSlots["subrosia seaside"].idAddrs[0].offset = codeAddr.offset + 2
+		rom.itemSlots["subrosia seaside"].subidAddrs[0].offset = codeAddr.offset + 5
+		codeAddr = rom.codeMutables["setHardOreIds"].addr
+		rom.itemSlots["great furnace"].idAddrs[0].offset = codeAddr.offset + 2
+		rom.itemSlots["great furnace"].subidAddrs[0].offset = codeAddr.offset + 5
+		codeAddr = rom.codeMutables["script_diverGiveItem"].addr
+		rom.itemSlots["master diver's reward"].idAddrs[0].offset = codeAddr.offset + 1
+		rom.itemSlots["master diver's reward"].subidAddrs[0].offset = codeAddr.offset + 2
+		codeAddr = rom.codeMutables["createMtCuccoItem"].addr
+		rom.itemSlots["mt. cucco, platform cave"].idAddrs[0].offset = codeAddr.offset + 2
+		rom.itemSlots["mt. cucco, platform cave"].subidAddrs[0].offset = codeAddr.offset + 1
+	} else {
+		mut := rom.codeMutables["script_soldierGiveItem"]
+		slot := rom.itemSlots["deku forest soldier"]
+		slot.idAddrs[0].offset = mut.addr.offset + 13
+		slot.subidAddrs[0].offset = mut.addr.offset + 14
+		mut = rom.codeMutables["script_giveTargetCartsSecondPrize"]
+		codeAddr := mut.addr
+		rom.itemSlots["target carts 2"].idAddrs[1].offset = codeAddr.offset + 1
+		rom.itemSlots["target carts 2"].subidAddrs[1].offset = codeAddr.offset + 2
+	}
+
+	rom.setBossItemAddrs()
+}
+
 // checks all the package's data against the ROM to see if it matches. It
 // returns a slice of errors describing each mismatch.
 func (rom *romState) verify() []error {
@@ -350,7 +360,9 @@ func (rom *romState) setTreasureMapData() {
 }
 
 // set dungeon properties so that the compass beeps in the rooms actually
-// containing small keys and boss keys.
+// containing small keys and boss keys. the game only plays the chime if link
+// has the current dungeon's compass, so shuffled compasses are still required
+// to hear it.
 func (rom *romState) setCompassData() {
 	prefixes := sora(rom.game,
 		[]string{"d0", "d1", "d2", "d3", "d4", "d5", "d6", "d7", "d8"},
@@ -388,6 +400,11 @@ func (rom *romState) setCompassData() {
 		}
 
 		for _, slot := range slots {
+			// only dungeon rooms have these properties, and keysanity can put
+			// keys elsewhere.
+			if slot.group != 4 && slot.group != 5 {
+				continue
+			}
 			offset := getDungeonPropertiesAddr(
 				rom.game, slot.group, slot.room).fullOffset()
 			rom.data[offset] = (rom.data[offset] & 0xbf) | 0x10 // set bit 4, reset bit 6
@@ -567,16 +584,15 @@ type warpData struct {
 	vanillaEntryData, vanillaExitData []byte // read from rom
 }
 
-func (rom *romState) setWarps(warpMap map[string]string, dungeons bool) {
-	// load yaml data
+// returns the warp data for the game, with vanilla data read from the ROM.
+func (rom *romState) loadWarps() map[string]*warpData {
 	wd := make(map[string](map[string]*warpData))
 	if err := yaml.Unmarshal(
-		FSMustByte(false, "/romdata/warps.yaml"), wd); err != nil {
+		mustReadData("/romdata/warps.yaml"), wd); err != nil {
 		panic(err)
 	}
 	warps := sora(rom.game, wd["seasons"], wd["ages"]).(map[string]*warpData)
 
-	// read vanilla data
 	for name, warp := range warps {
 		if strings.HasSuffix(name, "essence") {
 			warp.len = 4
@@ -596,6 +612,12 @@ func (rom *romState) setWarps(warpMap map[string]string, dungeons bool) {
 		warp.vanillaMapTile = warp.MapTile
 	}
 
+	return warps
+}
+
+func (rom *romState) setWarps(warpMap map[string]string, dungeons bool) {
+	warps := rom.loadWarps()
+
 	// ages needs essence warp data to d6 present entrance, even though it
 	// doesn't exist in vanilla.
 	if rom.game == gameAges {
@@ -684,12 +706,13 @@ func changeTreasureMapTiles(slots map[string]*itemSlot,
 }
 
 // set the string to display on the file select screen.
-func (rom *romState) setFileSelectText(row2 string) {
+func (rom *romState) setFileSelectText(row2 string) error {
+	if len(row2) > fileSelectWidth {
+		return fmt.Errorf("file select text too long: %s", row2)
+	}
+
 	// construct tiles from strings
-	version := strings.Replace(version, "beta", "bet", 1) // full won't fit
-	fileSelectRow1 := stringToTiles(strings.ToUpper(ternary(len(version) == 5,
-		fmt.Sprintf("randomizer %s", version),
-		fmt.Sprintf("rando %10s", version)[:16]).(string)))
+	fileSelectRow1 := fileSelectVersionTiles()
 	fileSelectRow2 := stringToTiles(
 		strings.ToUpper(strings.ReplaceAll(row2, "-", " ")))
 
@@ -702,6 +725,16 @@ func (rom *romState) setFileSelectText(row2 string) {
 	buf.Write(fileSelectRow2)
 	buf.Write(tiles.new[0x22+len(fileSelectRow2)+padding/2:])
 	tiles.new = buf.Bytes()
+	return nil
+}
+
+// returns the tiles for the first row of the file select text, which shows the
+// randomizer version.
+func fileSelectVersionTiles() []byte {
+	version := strings.Replace(version, "beta", "bet", 1) // full won't fit
+	return stringToTiles(strings.ToUpper(ternary(len(version) == 5,
+		fmt.Sprintf("randomizer %s", version),
+		fmt.Sprintf("rando %10s", version)[:16]).(string)))
 }
 
 // returns a conversion of the string to file select screen tile indexes, using
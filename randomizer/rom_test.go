@@ -1,6 +1,7 @@
 package randomizer
 
 import (
+	"strings"
 	"testing"
 )
 
@@ -27,3 +28,47 @@ func TestMutableOverlap(t *testing.T) {
 func TestProcessText(t *testing.T) {
 	testExpect(t, processText("A\\xff # hello\nB"), []byte{'A', 0xff, 'B'})
 }
+
+func TestFileSelectText(t *testing.T) {
+	o, err := newLogicOverlay("test.yaml", []byte("remove: [any satchel]"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// every flag that can appear at once
+	ropts := randomizerOptions{
+		treewarp:  true,
+		dungeons:  true,
+		portals:   true,
+		fill:      fillAssumed,
+		keys:      keysAnywhere,
+		maps:      mapsAnywhere,
+		starting:  []string{"feather"},
+		essences:  5,
+		excluded:  []string{"d1 stalfos drop"},
+		placement: placementRules{"sword": nil},
+		hints:     true,
+		tricks:    []string{"bomb jumps"},
+		overlay:   o,
+	}
+
+	for _, overlay := range []*logicOverlay{nil, o} {
+		ropts.overlay = overlay
+		s := fileSelectOptString(0x12345678, ropts)
+		if len(s) > fileSelectWidth || !strings.HasPrefix(s, "12345678+") {
+			t.Errorf("bad file select text: %q", s)
+		}
+		if overlay != nil && !strings.HasSuffix(s, "l"+o.shortSum()) {
+			t.Errorf("overlay sum missing from file select text: %q", s)
+		}
+	}
+
+	ropts = randomizerOptions{treewarp: true}
+	if s := fileSelectOptString(0x12345678, ropts); s != "12345678+t" {
+		t.Errorf("short file select text changed: %q", s)
+	}
+
+	rom := newRomState(nil, gameSeasons)
+	if err := rom.setFileSelectText("12345678+thdpawme5o"); err == nil {
+		t.Error("no error for text longer than the screen")
+	}
+}
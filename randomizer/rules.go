@@ -0,0 +1,257 @@
+package randomizer
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// implements the -rules flag: lightweight constraints on where specific items
+// can be placed, like "sword not in dungeons". the file is yaml in this
+// format:
+//
+//   sword:
+//     not in: [dungeons]
+//   flippers:
+//     in: [holodrum]
+//   progression: # every item that isn't inert
+//     not in: [member's shop 1, member's shop 2, member's shop 3]
+//
+// regions are the area names from hints/*_areas.yaml, check names, or one of
+// the groups in getRegions.
+
+// the item name that matches all items that aren't inert.
+const progressionRuleName = "progression"
+
+// restricts an item to a set of slots.
+type placementRule struct {
+	in    map[string]bool // nil if the item can go in any region
+	notIn map[string]bool
+}
+
+// maps item names to their rules.
+type placementRules map[string]*placementRule
+
+// loads placement rules from a yaml file.
+func loadPlacementRules(path string, game int) (placementRules, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parsePlacementRules(string(b), game)
+}
+
+// loads placement rules from a yaml string.
+func parsePlacementRules(source string, game int) (placementRules, error) {
+	raw := make(map[string]map[string][]string)
+	if err := yaml.UnmarshalStrict([]byte(source), raw); err != nil {
+		return nil, err
+	}
+
+	treasures := loadTreasures(nil, game)
+	regions := getRegions(game)
+	rules := make(placementRules)
+	for item, conds := range raw {
+		name := item
+		if name != progressionRuleName {
+			name = ungetNiceName(item, game)
+			if treasures[name] == nil &&
+				getStringIndex(seedNames, name) == -1 &&
+				getStringIndex(rings, name) == -1 {
+				return nil, fmt.Errorf("no such item in rules: %s", item)
+			}
+		}
+
+		rule := &placementRule{notIn: make(map[string]bool)}
+		for cond, regionNames := range conds {
+			var slots map[string]bool
+			switch cond {
+			case "in":
+				rule.in = make(map[string]bool)
+				slots = rule.in
+			case "not in":
+				slots = rule.notIn
+			default:
+				return nil, fmt.Errorf("unknown condition for %s: %q",
+					item, cond)
+			}
+
+			for _, region := range regionNames {
+				regionSlots := regions[ungetNiceName(region, game)]
+				if regionSlots == nil {
+					regionSlots = regions[strings.ToLower(region)]
+				}
+				if regionSlots == nil {
+					return nil, fmt.Errorf("no such region in rules: %s",
+						region)
+				}
+				for _, slot := range regionSlots {
+					slots[slot] = true
+				}
+			}
+		}
+		rules[name] = rule
+	}
+
+	return rules, nil
+}
+
+// returns a map of region names to the slots in them. these are the areas used
+// by owl hints and groups of them, in lowercase, plus each slot by itself.
+func getRegions(game int) map[string][]string {
+	regions := make(map[string][]string)
+	for slot, area := range newHinter(game).areas {
+		regions[slot] = append(regions[slot], slot)
+
+		dungeon := strings.HasPrefix(area, "Level ") || area == "Hero's Cave"
+		groups := []string{strings.ToLower(area),
+			ternary(dungeon, "dungeons", "overworld").(string)}
+		if game == gameSeasons && !dungeon {
+			if strings.Contains(area, "Subrosia") ||
+				area == "The Temple of Seasons" {
+				groups = append(groups, "subrosia")
+			} else {
+				groups = append(groups, "holodrum")
+			}
+		}
+
+		for _, group := range groups {
+			regions[group] = append(regions[group], slot)
+		}
+	}
+	return regions
+}
+
+// returns true iff the rule allows an item to be placed in the slot.
+func (rule *placementRule) allows(slot string) bool {
+	return (rule.in == nil || rule.in[slot]) && !rule.notIn[slot]
+}
+
+// returns true iff the rules allow the item to be placed in the slot.
+func (rules placementRules) allow(item, slot string, inert bool) bool {
+	if rule := rules[item]; rule != nil && !rule.allows(slot) {
+		return false
+	}
+	if rule := rules[progressionRuleName]; rule != nil && !inert &&
+		!rule.allows(slot) {
+		return false
+	}
+	return true
+}
+
+// returns an error if any placement rule can't be satisfied by the slots in
+// the ROM, given the other placement constraints of the route. excluded slots
+// are also checked.
+func checkPlacementRules(ri *routeInfo, rom *romState) error {
+	// seed trees can only hold seeds, which aren't inert
+	for _, name := range orderedKeys(rom.itemSlots) {
+		if !seedTreeNames[name] {
+			continue
+		}
+		ok := false
+		for _, seed := range seedNames {
+			ok = ok || (!ri.excluded[name] &&
+				ri.placement.allow(seed, name, false))
+		}
+		if !ok {
+			return fmt.Errorf("%s can only hold seeds",
+				getNiceName(name, rom.game))
+		}
+	}
+
+	// count the items in the vanilla pool, and the progression items
+	counts := make(map[string]int)
+	for _, slot := range rom.itemSlots {
+		name, _ := reverseLookup(rom.treasures, slot.treasure)
+		counts[name.(string)]++
+		if !itemIsInert(rom.treasures, name.(string)) {
+			counts[progressionRuleName]++
+		}
+	}
+
+	for _, item := range orderedKeys(ri.placement) {
+		rule := ri.placement[item]
+		progression := item == progressionRuleName ||
+			!itemIsInert(rom.treasures, item)
+		itemNode := newNode(item, orNode)
+
+		n := 0
+		for name := range rom.itemSlots {
+			if !rule.allows(name) || (progression && ri.excluded[name]) {
+				continue
+			}
+			if item != progressionRuleName &&
+				!itemFitsInSlot(itemNode, newNode(name, orNode), ri.rules) {
+				continue
+			}
+			n++
+		}
+		if n == 0 {
+			return fmt.Errorf("no check satisfies the rules for %s",
+				getNiceName(item, rom.game))
+		} else if n < counts[item] {
+			return fmt.Errorf("only %d checks satisfy the rules for %s, "+
+				"but %d are needed",
+				n, getNiceName(item, rom.game), counts[item])
+		}
+	}
+
+	return checkRegionCapacity(ri, rom)
+}
+
+// returns an error if the items that can only go in some region outnumber
+// the checks in it. this catches rules that are satisfiable one at a time but
+// not together, including with dungeon items that have to go in their own
+// dungeons.
+func checkRegionCapacity(ri *routeInfo, rom *romState) error {
+	// get the checks that each item in the pool can go in. rings are left
+	// out, since the ring pool is random.
+	pool := getVanillaPool(rom, ri.starting)
+	allowed := make(map[string]map[string]bool)
+	for _, item := range orderedKeys(pool) {
+		if getStringIndex(rings, item) != -1 {
+			continue
+		}
+		allowed[item] = make(map[string]bool)
+		for slot := range rom.itemSlots {
+			if ri.slotAccepts(newNode(item, orNode), newNode(slot, orNode),
+				rom.treasures) {
+				allowed[item][slot] = true
+			}
+		}
+		if len(allowed[item]) == 0 {
+			return fmt.Errorf("no check can hold %s",
+				getNiceName(item, rom.game))
+		}
+	}
+
+	regions := getRegions(rom.game)
+	for _, region := range orderedKeys(regions) {
+		slots := make(map[string]bool, len(regions[region]))
+		for _, slot := range regions[region] {
+			slots[slot] = true
+		}
+
+		n := 0
+		for item, itemSlots := range allowed {
+			if len(itemSlots) > len(slots) {
+				continue
+			}
+			inRegion := true
+			for slot := range itemSlots {
+				inRegion = inRegion && slots[slot]
+			}
+			if inRegion {
+				n += pool[item]
+			}
+		}
+		if n > len(slots) {
+			return fmt.Errorf("%d items can only go in %s, which has %d checks",
+				n, region, len(slots))
+		}
+	}
+
+	return nil
+}
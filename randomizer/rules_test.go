@@ -0,0 +1,92 @@
+package randomizer
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestPlacementRules(t *testing.T) {
+	for _, source := range []string{
+		"not an item: {in: [dungeons]}",
+		"sword: {in: [not a region]}",
+		"sword: {near: [dungeons]}",
+	} {
+		if _, err := parsePlacementRules(source, gameSeasons); err == nil {
+			t.Errorf("invalid rules accepted: %q", source)
+		}
+	}
+
+	logf := func(string, ...interface{}) {}
+
+	// rules that can't be satisfied should fail early with a clear error
+	rules, err := parsePlacementRules(
+		"d1 small key: {in: [Horon Village]}", gameSeasons)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ropts := randomizerOptions{placement: rules}
+	if _, err := findRoute(context.Background(), newRomState(nil, gameSeasons),
+		0x1234, ropts, false, logf); err == nil {
+		t.Error("unsatisfiable rules accepted")
+	}
+	rules, err = parsePlacementRules(
+		"progression: {not in: [horon village tree]}", gameSeasons)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ropts = randomizerOptions{placement: rules}
+	if _, err := findRoute(context.Background(), newRomState(nil, gameSeasons),
+		0x1234, ropts, false, logf); err == nil {
+		t.Error("rules excluding seeds from a seed tree accepted")
+	}
+
+	// rules that are satisfiable alone but not together
+	rules, err = parsePlacementRules(`
+sword: {in: [level 1]}
+feather: {in: [level 1]}
+bracelet: {in: [level 1]}
+boomerang: {in: [level 1]}
+shovel: {in: [level 1]}
+satchel: {in: [level 1]}`, gameSeasons)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ropts = randomizerOptions{placement: rules}
+	if _, err := findRoute(context.Background(), newRomState(nil, gameSeasons),
+		0x1234, ropts, false, logf); err == nil ||
+		!strings.Contains(err.Error(), "level 1") {
+		t.Errorf("got error %v for overfilled region", err)
+	}
+
+	for game, source := range map[int]string{
+		gameSeasons: `
+sword: {not in: [dungeons]}
+flippers: {in: [holodrum]}
+progression: {not in: [member's shop 1, member's shop 2, member's shop 3]}`,
+		gameAges: `
+sword: {not in: [dungeons]}
+progression: {not in: [Talus Peaks, goron shooting gallery]}`,
+	} {
+		rules, err := parsePlacementRules(source, game)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rom := newRomState(nil, game)
+		ropts := randomizerOptions{placement: rules}
+		ri, err := findRoute(
+			context.Background(), rom, 0x1234, ropts, false, logf)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for slot, item := range getChecks(ri.usedItems, ri.usedSlots) {
+			inert := itemIsInert(rom.treasures, item.name)
+			if !rules.allow(item.name, slot.name, inert) {
+				t.Errorf("%s: %s holds %s", gameNames[game],
+					slot.name, item.name)
+			}
+		}
+	}
+}
@@ -0,0 +1,411 @@
+package randomizer
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// implements the serve subcommand, a local HTTP API for generating seeds:
+//
+//   POST   /roms                   upload a vanilla ROM; returns its ID
+//   GET    /roms                   list known ROMs
+//   POST   /seeds                  {"rom": id, "options": {...}}; returns a
+//                                  job ID. options are as in Options.
+//   GET    /seeds/<id>             job status and progress
+//   DELETE /seeds/<id>             cancel a job
+//   GET    /seeds/<id>/rom         randomized ROM
+//   GET    /seeds/<id>/patch       bps patch for the vanilla ROM
+//   GET    /seeds/<id>/spoiler     text spoiler log (not for race seeds)
+//   GET    /seeds/<id>/spoiler.json
+//
+// ROM IDs are SHA-1 sums, so vanilla ROMs given on the command line can be
+// referenced without uploading them.
+
+const (
+	maxUploadSize    = 4 << 20 // bytes
+	maxFinishedJobs  = 100     // older finished jobs are forgotten
+	serverQueueSize  = 32
+	defaultServeAddr = "localhost:8080"
+)
+
+// job states.
+const (
+	jobQueued   = "queued"
+	jobRunning  = "running"
+	jobDone     = "done"
+	jobFailed   = "failed"
+	jobCanceled = "canceled"
+)
+
+type serverJob struct {
+	id     string
+	rom    []byte
+	opts   Options
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// guarded by the server's mutex
+	state    string
+	progress string
+	err      error
+	result   *Result
+}
+
+// the json representation of a job's status.
+type jobStatus struct {
+	ID        string `json:"id"`
+	State     string `json:"state"`
+	Progress  string `json:"progress,omitempty"`
+	Error     string `json:"error,omitempty"`
+	Seed      string `json:"seed,omitempty"`
+	SHA1      string `json:"sha1,omitempty"`
+	Settings  string `json:"settings,omitempty"`
+	OptString string `json:"optString,omitempty"`
+}
+
+type server struct {
+	mu       sync.Mutex
+	roms     map[string][]byte // by SHA-1 sum
+	jobs     map[string]*serverJob
+	finished []string // IDs of finished jobs, oldest first
+	queue    chan *serverJob
+
+	// does the actual work. replaceable for testing.
+	run func(context.Context, []byte, Options, logFunc) (*Result, error)
+}
+
+// returns a server that runs jobs on the given number of goroutines.
+func newServer(workers int) *server {
+	s := &server{
+		roms:  make(map[string][]byte),
+		jobs:  make(map[string]*serverJob),
+		queue: make(chan *serverJob, serverQueueSize),
+		run:   randomizeBytes,
+	}
+	for i := 0; i < workers; i++ {
+		go s.work()
+	}
+	return s
+}
+
+// adds a vanilla ROM and returns its ID.
+func (s *server) addRom(b []byte) (id string, game int, err error) {
+	if game, err = checkGivenRom(b, "uploaded ROM"); err != nil {
+		return "", gameNil, err
+	}
+	sum := sha1.Sum(b)
+	id = hex.EncodeToString(sum[:])
+
+	s.mu.Lock()
+	s.roms[id] = b
+	s.mu.Unlock()
+
+	return id, game, nil
+}
+
+// processes jobs from the queue until the program exits.
+func (s *server) work() {
+	for job := range s.queue {
+		s.mu.Lock()
+		if job.state == jobCanceled {
+			s.mu.Unlock()
+			continue
+		}
+		job.state = jobRunning
+		s.mu.Unlock()
+
+		result, err := s.runJob(job)
+
+		s.mu.Lock()
+		if job.state != jobCanceled {
+			if err != nil {
+				job.state, job.err = jobFailed, err
+			} else {
+				job.state, job.result = jobDone, result
+			}
+		}
+		s.finish(job)
+		s.mu.Unlock()
+		job.cancel()
+	}
+}
+
+// runs a job, turning a panic into an error so that one bad request can't
+// take down the server.
+func (s *server) runJob(job *serverJob) (result *Result, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			result, err = nil, fmt.Errorf("internal error: %v", r)
+		}
+	}()
+
+	return s.run(job.ctx, job.rom, job.opts,
+		func(format string, a ...interface{}) {
+			s.mu.Lock()
+			job.progress = fmt.Sprintf(format, a...)
+			s.mu.Unlock()
+		})
+}
+
+// records a job as finished, forgetting the oldest finished job if there are
+// too many. the caller must hold the mutex.
+func (s *server) finish(job *serverJob) {
+	s.finished = append(s.finished, job.id)
+	if len(s.finished) > maxFinishedJobs {
+		delete(s.jobs, s.finished[0])
+		s.finished = s.finished[1:]
+	}
+}
+
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+
+	switch {
+	case len(path) == 1 && path[0] == "roms":
+		switch r.Method {
+		case http.MethodGet:
+			s.listRoms(w)
+		case http.MethodPost:
+			s.uploadRom(w, r)
+		default:
+			httpError(w, http.StatusMethodNotAllowed, "method not allowed")
+		}
+	case len(path) == 1 && path[0] == "seeds":
+		if r.Method == http.MethodPost {
+			s.startJob(w, r)
+		} else {
+			httpError(w, http.StatusMethodNotAllowed, "method not allowed")
+		}
+	case len(path) == 2 && path[0] == "seeds":
+		switch r.Method {
+		case http.MethodGet:
+			s.getStatus(w, path[1])
+		case http.MethodDelete:
+			s.cancelJob(w, path[1])
+		default:
+			httpError(w, http.StatusMethodNotAllowed, "method not allowed")
+		}
+	case len(path) == 3 && path[0] == "seeds" && r.Method == http.MethodGet:
+		s.getOutput(w, path[1], path[2])
+	default:
+		httpError(w, http.StatusNotFound, "not found")
+	}
+}
+
+func (s *server) listRoms(w http.ResponseWriter) {
+	s.mu.Lock()
+	roms := make(map[string]string)
+	for id, b := range s.roms {
+		roms[id] = gameNames[ternary(romIsSeasons(b),
+			gameSeasons, gameAges).(int)]
+	}
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, roms)
+}
+
+func (s *server) uploadRom(w http.ResponseWriter, r *http.Request) {
+	b, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxUploadSize))
+	if err != nil {
+		httpError(w, http.StatusRequestEntityTooLarge, err.Error())
+		return
+	}
+	id, game, err := s.addRom(b)
+	if err != nil {
+		httpError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{
+		"id":   id,
+		"game": gameNames[game],
+	})
+}
+
+func (s *server) startJob(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ROM     string  `json:"rom"`
+		Options Options `json:"options"`
+	}
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxUploadSize))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		httpError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	id, err := newJobID()
+	if err != nil {
+		httpError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	job := &serverJob{
+		id:     id,
+		opts:   req.Options,
+		ctx:    ctx,
+		cancel: cancel,
+		state:  jobQueued,
+	}
+
+	s.mu.Lock()
+	job.rom = s.roms[strings.ToLower(req.ROM)]
+	if job.rom == nil {
+		s.mu.Unlock()
+		cancel()
+		httpError(w, http.StatusBadRequest, "no such ROM: "+req.ROM)
+		return
+	}
+	select {
+	case s.queue <- job:
+		s.jobs[id] = job
+		s.mu.Unlock()
+	default:
+		s.mu.Unlock()
+		cancel()
+		httpError(w, http.StatusServiceUnavailable, "too many queued jobs")
+		return
+	}
+
+	writeJSON(w, http.StatusAccepted, map[string]string{"id": id})
+}
+
+func (s *server) getStatus(w http.ResponseWriter, id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job := s.jobs[id]
+	if job == nil {
+		httpError(w, http.StatusNotFound, "no such job: "+id)
+		return
+	}
+
+	status := jobStatus{ID: id, State: job.state, Progress: job.progress}
+	if job.err != nil {
+		status.Error = job.err.Error()
+	}
+	if res := job.result; res != nil {
+		if !job.opts.Race {
+			status.Seed = fmt.Sprintf("%08x", res.Seed)
+			status.Settings = res.Settings
+		}
+		status.SHA1 = fmt.Sprintf("%x", res.SHA1)
+		status.OptString = res.OptString
+	}
+
+	writeJSON(w, http.StatusOK, status)
+}
+
+func (s *server) cancelJob(w http.ResponseWriter, id string) {
+	s.mu.Lock()
+	job := s.jobs[id]
+	if job != nil && (job.state == jobQueued || job.state == jobRunning) {
+		if job.state == jobQueued {
+			s.finish(job)
+		}
+		job.state, job.rom = jobCanceled, nil
+		job.cancel()
+	}
+	s.mu.Unlock()
+
+	if job == nil {
+		httpError(w, http.StatusNotFound, "no such job: "+id)
+		return
+	}
+	s.getStatus(w, id)
+}
+
+func (s *server) getOutput(w http.ResponseWriter, id, name string) {
+	s.mu.Lock()
+	job := s.jobs[id]
+	var res *Result
+	var vanilla []byte
+	var race bool
+	if job != nil {
+		res, vanilla, race = job.result, job.rom, job.opts.Race
+	}
+	s.mu.Unlock()
+
+	if res == nil {
+		httpError(w, http.StatusNotFound, "no finished job: "+id)
+		return
+	}
+
+	var b []byte
+	var contentType, filename string
+	base := fmt.Sprintf("%srando_%s_%s",
+		ternary(res.Game == "seasons", "oos", "ooa"), version, res.OptString)
+	switch name {
+	case "rom":
+		b, contentType, filename = res.ROM, "application/octet-stream",
+			base+".gbc"
+	case "patch":
+		b, contentType, filename = makeBPS(vanilla, res.ROM),
+			"application/octet-stream", base+".bps"
+	case "spoiler":
+		b, contentType, filename = res.Spoiler, "text/plain; charset=utf-8",
+			base+"_log.txt"
+	case "spoiler.json":
+		b, contentType, filename = res.JSONLog, "application/json",
+			base+"_log.json"
+	default:
+		httpError(w, http.StatusNotFound, "not found")
+		return
+	}
+	if race && strings.HasPrefix(name, "spoiler") {
+		httpError(w, http.StatusForbidden, "no spoiler for race seeds")
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition",
+		fmt.Sprintf("attachment; filename=%q", filename))
+	w.Write(b)
+}
+
+// returns a random hex job ID.
+func newJobID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+func httpError(w http.ResponseWriter, code int, msg string) {
+	writeJSON(w, code, map[string]string{"error": msg})
+}
+
+// runs the server until it fails. roms are paths to vanilla ROMs to make
+// available without uploading.
+func serve(addr string, workers int, roms []string, logf logFunc) error {
+	s := newServer(workers)
+	for _, path := range roms {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		id, game, err := s.addRom(b)
+		if err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		logf("loaded %s ROM %s as %s", gameNames[game], path, id)
+	}
+
+	logf("listening on http://%s", addr)
+	return http.ListenAndServe(addr, s)
+}
@@ -0,0 +1,108 @@
+package randomizer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServer(t *testing.T) {
+	s := newServer(1)
+	block := make(chan bool)
+	s.run = func(ctx context.Context, rom []byte, opts Options,
+		logf logFunc) (*Result, error) {
+		logf("searching...")
+		if opts.Race {
+			panic("oops")
+		}
+		if opts.Hard {
+			select {
+			case <-block:
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+		return &Result{ROM: rom, Game: "seasons", Spoiler: []byte("log"),
+			OptString: "00000000"}, nil
+	}
+	s.roms["abcd"] = []byte("not really a ROM")
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	do := func(method, path, body string, v interface{}) int {
+		req, err := http.NewRequest(method, ts.URL+path,
+			bytes.NewBufferString(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if v != nil {
+			json.NewDecoder(resp.Body).Decode(v)
+		}
+		return resp.StatusCode
+	}
+	wait := func(id, state string) {
+		for i := 0; i < 100; i++ {
+			var status jobStatus
+			do("GET", "/seeds/"+id, "", &status)
+			if status.State == state {
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Fatalf("job %s never became %s", id, state)
+	}
+
+	if code := do("POST", "/roms", "not a ROM", nil); code != 400 {
+		t.Errorf("uploading invalid ROM gave %d", code)
+	}
+	if code := do("POST", "/seeds", `{"rom": "ffff"}`, nil); code != 400 {
+		t.Errorf("using unknown ROM gave %d", code)
+	}
+	if code := do("GET", "/seeds/nope", "", nil); code != 404 {
+		t.Errorf("unknown job gave %d", code)
+	}
+
+	// normal job
+	var job map[string]string
+	if code := do("POST", "/seeds", `{"rom": "abcd"}`, &job); code != 202 {
+		t.Fatalf("starting job gave %d", code)
+	}
+	wait(job["id"], jobDone)
+	if code := do("GET", "/seeds/"+job["id"]+"/spoiler", "", nil); code != 200 {
+		t.Errorf("getting spoiler gave %d", code)
+	}
+
+	// job that panics, which shouldn't stop later jobs
+	body := `{"rom": "abcd", "options": {"Race": true}}`
+	if code := do("POST", "/seeds", body, &job); code != 202 {
+		t.Fatalf("starting job gave %d", code)
+	}
+	wait(job["id"], jobFailed)
+	var status jobStatus
+	do("GET", "/seeds/"+job["id"], "", &status)
+	if !strings.Contains(status.Error, "oops") {
+		t.Errorf("wrong error for panicking job: %q", status.Error)
+	}
+
+	// canceled job
+	body = `{"rom": "abcd", "options": {"Hard": true}}`
+	if code := do("POST", "/seeds", body, &job); code != 202 {
+		t.Fatalf("starting job gave %d", code)
+	}
+	wait(job["id"], jobRunning)
+	do("DELETE", "/seeds/"+job["id"], "", nil)
+	wait(job["id"], jobCanceled)
+	if code := do("GET", "/seeds/"+job["id"]+"/rom", "", nil); code != 404 {
+		t.Errorf("getting ROM of canceled job gave %d", code)
+	}
+}
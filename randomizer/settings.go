@@ -0,0 +1,276 @@
+package randomizer
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/base64"
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// settings strings encode a seed and every option that affects the generated
+// ROM, for sharing seeds. the first byte is the format version; the rest is a
+// deflated payload. the whole thing is then base64-encoded using URL-safe
+// characters. cosmetic options, if any are added, should go in a separate
+// string so that players can share settings without sharing preferences.
+//
+// version 2 payload:
+//
+//   game (1 byte)
+//   seed (4 bytes, big-endian)
+//   option bits (2 bytes, see settingsBits)
+//   required essences (1 byte)
+//   fill, keysanity, and maps indexes + 1 (1 byte each; 0 is the default)
+//   hint mix (string)
+//   starting items (string list)
+//   excluded locations (string list)
+//   placement rules (uvarint count, then item name, "in" flag byte, "in"
+//     slots if the flag is set, and "not in" slots for each rule)
+//   tricks (string list)
+//
+// version 1 is the same, minus the tricks.
+//
+// strings are a uvarint length followed by bytes, and lists are a uvarint
+// count followed by strings.
+
+const settingsVersion = 2
+
+// bit flags for boolean options. don't reorder these!
+var settingsBits = []func(*randomizerOptions) *bool{
+	func(ro *randomizerOptions) *bool { return &ro.treewarp },
+	func(ro *randomizerOptions) *bool { return &ro.hard },
+	func(ro *randomizerOptions) *bool { return &ro.dungeons },
+	func(ro *randomizerOptions) *bool { return &ro.portals },
+	func(ro *randomizerOptions) *bool { return &ro.bossOnly },
+	func(ro *randomizerOptions) *bool { return &ro.hints },
+	func(ro *randomizerOptions) *bool { return &ro.race },
+}
+
+// returns the settings string for the given game, seed, and options. plans
+// and logic overlays aren't encoded.
+func encodeSettings(game int, seed uint32, ropts randomizerOptions) string {
+	payload := new(bytes.Buffer)
+	payload.WriteByte(byte(game))
+	binary.Write(payload, binary.BigEndian, seed)
+
+	var bits uint16
+	for i, bit := range settingsBits {
+		if *bit(&ropts) {
+			bits |= 1 << uint(i)
+		}
+	}
+	binary.Write(payload, binary.BigEndian, bits)
+
+	payload.WriteByte(byte(ropts.requiredEssences()))
+	payload.WriteByte(byte(getStringIndex(fillAlgorithms, ropts.fill) + 1))
+	payload.WriteByte(byte(getStringIndex(keysanityLevels, ropts.keys) + 1))
+	payload.WriteByte(byte(getStringIndex(mapsLevels, ropts.maps) + 1))
+
+	writeSettingsString(payload, ropts.hintMix)
+	writeSettingsList(payload, ropts.starting)
+	writeSettingsList(payload, ropts.excluded)
+
+	writeSettingsUvarint(payload, len(ropts.placement))
+	for _, item := range orderedKeys(ropts.placement) {
+		rule := ropts.placement[item]
+		writeSettingsString(payload, item)
+		if rule.in != nil {
+			payload.WriteByte(1)
+			writeSettingsList(payload, orderedKeys(rule.in))
+		} else {
+			payload.WriteByte(0)
+		}
+		writeSettingsList(payload, orderedKeys(rule.notIn))
+	}
+
+	writeSettingsList(payload, ropts.tricks)
+
+	b := new(bytes.Buffer)
+	b.WriteByte(settingsVersion)
+	w, _ := flate.NewWriter(b, flate.BestCompression)
+	w.Write(payload.Bytes())
+	w.Close()
+
+	return base64.RawURLEncoding.EncodeToString(b.Bytes())
+}
+
+// decodes a settings string into options for the given game. the returned
+// options' seed is always set.
+func decodeSettings(s string, game int) (randomizerOptions, error) {
+	var ropts randomizerOptions
+	invalid := fmt.Errorf("invalid settings string")
+
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) == 0 {
+		return ropts, invalid
+	}
+	version := b[0]
+	if version < 1 || version > settingsVersion {
+		return ropts, fmt.Errorf("settings string is version %d, but this "+
+			"randomizer only supports up to version %d", version,
+			settingsVersion)
+	}
+	payload, err := ioutil.ReadAll(flate.NewReader(bytes.NewReader(b[1:])))
+	if err != nil {
+		return ropts, invalid
+	}
+
+	r := &settingsReader{r: bytes.NewReader(payload)}
+	if g := int(r.byte()); r.err == nil && g != game {
+		return ropts, fmt.Errorf("settings string is for %s, not %s",
+			gameNames[g], gameNames[game])
+	}
+
+	var seed uint32
+	if r.err == nil {
+		r.err = binary.Read(r.r, binary.BigEndian, &seed)
+	}
+	ropts.seed = fmt.Sprintf("%08x", seed)
+
+	var bits uint16
+	if r.err == nil {
+		r.err = binary.Read(r.r, binary.BigEndian, &bits)
+	}
+	for i, bit := range settingsBits {
+		*bit(&ropts) = bits&(1<<uint(i)) != 0
+	}
+
+	ropts.essences = int(r.byte())
+	ropts.fill = r.index(fillAlgorithms)
+	ropts.keys = r.index(keysanityLevels)
+	ropts.maps = r.index(mapsLevels)
+	ropts.hintMix = r.string()
+	ropts.starting = r.list()
+	ropts.excluded = r.list()
+
+	if n := r.uvarint(); n > 0 {
+		ropts.placement = make(placementRules)
+		for i := 0; i < n && r.err == nil; i++ {
+			item := r.string()
+			rule := &placementRule{notIn: make(map[string]bool)}
+			if r.byte() != 0 {
+				rule.in = make(map[string]bool)
+				for _, slot := range r.list() {
+					rule.in[slot] = true
+				}
+			}
+			for _, slot := range r.list() {
+				rule.notIn[slot] = true
+			}
+			ropts.placement[item] = rule
+		}
+	}
+
+	if version >= 2 {
+		ropts.tricks = r.list()
+	}
+
+	if r.err != nil || r.r.Len() != 0 {
+		return randomizerOptions{}, invalid
+	}
+	if err := ropts.validate(game); err != nil {
+		return randomizerOptions{}, err
+	}
+	return ropts, nil
+}
+
+// flags that -settings doesn't replace, besides the ones that can't be in
+// presets.
+var settingsCompatibleFlags = map[string]bool{
+	"asm":           true,
+	"logic-overlay": true,
+	"playthrough":   true,
+}
+
+// returns an error if any flags that a settings string would replace were
+// given on the command line, since they'd be silently ignored otherwise.
+func checkSettingsFlags(fs *flag.FlagSet) error {
+	var err error
+	fs.Visit(func(f *flag.Flag) {
+		if err == nil && (f.Name == "preset" || f.Name == "seed" ||
+			!nonPresetFlags[f.Name] && !settingsCompatibleFlags[f.Name]) {
+			err = fmt.Errorf("can't use -%s with -settings", f.Name)
+		}
+	})
+	return err
+}
+
+func writeSettingsUvarint(w *bytes.Buffer, n int) {
+	buf := make([]byte, binary.MaxVarintLen64)
+	w.Write(buf[:binary.PutUvarint(buf, uint64(n))])
+}
+
+func writeSettingsString(w *bytes.Buffer, s string) {
+	writeSettingsUvarint(w, len(s))
+	w.WriteString(s)
+}
+
+func writeSettingsList(w *bytes.Buffer, a []string) {
+	writeSettingsUvarint(w, len(a))
+	for _, s := range a {
+		writeSettingsString(w, s)
+	}
+}
+
+// reads settings payload data, remembering the first error so that callers
+// can check it once at the end.
+type settingsReader struct {
+	r   *bytes.Reader
+	err error
+}
+
+func (sr *settingsReader) byte() byte {
+	if sr.err != nil {
+		return 0
+	}
+	var b byte
+	b, sr.err = sr.r.ReadByte()
+	return b
+}
+
+func (sr *settingsReader) uvarint() int {
+	if sr.err != nil {
+		return 0
+	}
+	var n uint64
+	n, sr.err = binary.ReadUvarint(sr.r)
+	if sr.err == nil && n > uint64(sr.r.Len()) {
+		// every counted thing takes at least one byte
+		sr.err = io.ErrUnexpectedEOF
+	}
+	if sr.err != nil {
+		return 0
+	}
+	return int(n)
+}
+
+func (sr *settingsReader) string() string {
+	b := make([]byte, sr.uvarint())
+	if sr.err == nil {
+		_, sr.err = io.ReadFull(sr.r, b)
+	}
+	return string(b)
+}
+
+func (sr *settingsReader) list() []string {
+	a := make([]string, sr.uvarint())
+	for i := range a {
+		a[i] = sr.string()
+	}
+	return a
+}
+
+// reads an index into a list of option values, with 0 meaning "".
+func (sr *settingsReader) index(values []string) string {
+	i := int(sr.byte())
+	if i == 0 {
+		return ""
+	} else if i > len(values) {
+		sr.err = fmt.Errorf("index out of range")
+		return ""
+	}
+	return values[i-1]
+}
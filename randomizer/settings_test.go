@@ -0,0 +1,112 @@
+package randomizer
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/base64"
+	"flag"
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+func TestSettingsString(t *testing.T) {
+	rules, err := parsePlacementRules(
+		"sword: {not in: [dungeons]}\nflippers: {in: [holodrum]}",
+		gameSeasons)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ropts := randomizerOptions{
+		treewarp:  true,
+		dungeons:  true,
+		portals:   true,
+		essences:  5,
+		fill:      fillAssumed,
+		keys:      keysAnywhere,
+		maps:      mapsVanilla,
+		starting:  []string{"feather", "power ring L-1"},
+		excluded:  []string{"blaino prize", "subrosian dance hall"},
+		placement: rules,
+		tricks:    []string{"bomb jumps", "mystery fire"},
+		hints:     true,
+		hintMix:   "woth=2,barren=2",
+		seed:      "1234abcd",
+	}
+
+	s := encodeSettings(gameSeasons, 0x1234abcd, ropts)
+	decoded, err := decodeSettings(s, gameSeasons)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(ropts, decoded) {
+		t.Errorf("settings changed in round trip: %+v != %+v", ropts, decoded)
+	}
+
+	// errors
+	if _, err := decodeSettings(s, gameAges); err == nil {
+		t.Error("settings for wrong game accepted")
+	}
+	b, _ := base64.RawURLEncoding.DecodeString(s)
+	b[0] = settingsVersion + 1
+	if _, err := decodeSettings(
+		base64.RawURLEncoding.EncodeToString(b), gameSeasons); err == nil {
+		t.Error("settings with wrong version accepted")
+	}
+	agesOpts := randomizerOptions{tricks: []string{"cape jump 6"}}
+	if _, err := decodeSettings(encodeSettings(gameAges, 0, agesOpts),
+		gameAges); err == nil {
+		t.Error("settings with trick from wrong game accepted")
+	}
+
+	// version 1 strings have no tricks
+	tail := new(bytes.Buffer)
+	writeSettingsList(tail, ropts.tricks)
+	ropts.tricks = nil
+	payload, _ := ioutil.ReadAll(flate.NewReader(bytes.NewReader(b[1:])))
+	payload = payload[:len(payload)-tail.Len()]
+	v1 := bytes.NewBuffer([]byte{1})
+	w, _ := flate.NewWriter(v1, flate.BestCompression)
+	w.Write(payload)
+	w.Close()
+	decoded, err = decodeSettings(
+		base64.RawURLEncoding.EncodeToString(v1.Bytes()), gameSeasons)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(ropts, decoded) {
+		t.Errorf("version 1 settings decoded wrong: %+v != %+v",
+			ropts, decoded)
+	}
+
+	for _, s := range []string{"", "!!", s[:len(s)/2]} {
+		if _, err := decodeSettings(s, gameSeasons); err == nil {
+			t.Errorf("invalid settings string accepted: %q", s)
+		}
+	}
+}
+
+func TestSettingsFlags(t *testing.T) {
+	// reset the flag variables afterward
+	defer defineFlags(flag.NewFlagSet("reset", flag.ContinueOnError))
+
+	for _, c := range []struct {
+		args []string
+		ok   bool
+	}{
+		{[]string{"-settings", "x", "-playthrough", "-noui"}, true},
+		{[]string{"-settings", "x", "-asm", "x.yaml"}, true},
+		{[]string{"-settings", "x", "-hard"}, false},
+		{[]string{"-settings", "x", "-seed", "1234"}, false},
+		{[]string{"-settings", "x", "-preset", "x"}, false},
+	} {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		defineFlags(fs)
+		if err := fs.Parse(c.args); err != nil {
+			t.Fatal(err)
+		}
+		if err := checkSettingsFlags(fs); (err == nil) != c.ok {
+			t.Errorf("%v: got error %v", c.args, err)
+		}
+	}
+}
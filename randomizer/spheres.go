@@ -4,6 +4,7 @@ import (
 	"container/list"
 	"fmt"
 	"sort"
+	"strings"
 )
 
 // getChecks converts a route info into a map of checks.
@@ -32,14 +33,20 @@ func getSpheres(g graph, checks map[*node]*node) ([][]*node, []*node) {
 	// need to track unreached items so that unreached dungeon items etc can
 	// have their parents restored even if they're not reachable yet.
 	unreachedChecks := make(map[*node]*node)
-	for slot, item := range checks {
-		// don't delimit spheres by intra-dungeon keys -- it obscures "actual"
-		// progression in the log file.
-		if !keyRegexp.MatchString(item.name) {
-			unreachedChecks[slot] = item
-			item.removeParent(slot)
+	g.batch(func() {
+		for slot, item := range checks {
+			// don't delimit spheres by intra-dungeon keys -- it obscures
+			// "actual" progression in the log file. keys outside their own
+			// dungeon still count, since they're progression like any other
+			// item.
+			if !keyRegexp.MatchString(item.name) ||
+				!strings.HasPrefix(getDungeonName(slot.name),
+					getDungeonName(item.name)) {
+				unreachedChecks[slot] = item
+				item.removeParent(slot)
+			}
 		}
-	}
+	})
 
 	for {
 		sphere := make([]*node, 0)
@@ -72,9 +79,11 @@ func getSpheres(g graph, checks map[*node]*node) ([][]*node, []*node) {
 		spheres = append(spheres, sphere)
 	}
 
-	for slot, item := range unreachedChecks {
-		item.addParent(slot)
-	}
+	g.batch(func() {
+		for slot, item := range unreachedChecks {
+			item.addParent(slot)
+		}
+	})
 
 	extra := make([]*node, 0)
 	for slot, item := range checks {
@@ -137,3 +146,61 @@ func logSpheres(summary chan string, checks map[*node]*node,
 		}
 	}
 }
+
+// getPlaythrough returns spheres as in getSpheres, but containing only checks
+// that are needed to reach the goal, so that no check can be removed without
+// making the seed unbeatable. checks are removed latest sphere first, so that
+// early items are preferred when there's a choice.
+func getPlaythrough(g graph, checks map[*node]*node,
+	treasures map[string]*treasure) [][]*node {
+	spheres, _ := getSpheres(g, checks)
+
+	removed := make(map[*node]*node)
+	for i := len(spheres) - 1; i >= 0; i-- {
+		for _, slot := range spheres[i] {
+			item := checks[slot]
+			if item == nil || (itemIsInert(treasures, item.name) &&
+				!strings.HasPrefix(item.name, "rupees")) {
+				continue
+			}
+
+			item.removeParent(slot)
+			g.reset()
+			g["start"].explore()
+			if g["done"].reached {
+				removed[slot] = item
+			} else {
+				item.addParent(slot)
+			}
+		}
+	}
+
+	required := make(map[*node]*node)
+	for slot, item := range checks {
+		if removed[slot] == nil {
+			required[slot] = item
+		}
+	}
+	playthrough, _ := getSpheres(g, required)
+
+	for slot, item := range removed {
+		item.addParent(slot)
+	}
+
+	// keep only spheres with required items in them
+	compact := make([][]*node, 0, len(playthrough))
+	for _, sphere := range playthrough {
+		nodes := make([]*node, 0, len(sphere))
+		for _, n := range sphere {
+			if item := checks[n]; item != nil &&
+				(!itemIsInert(treasures, item.name) ||
+					strings.HasPrefix(item.name, "rupees")) {
+				nodes = append(nodes, n)
+			}
+		}
+		if len(nodes) > 0 {
+			compact = append(compact, nodes)
+		}
+	}
+	return compact
+}
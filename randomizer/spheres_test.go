@@ -0,0 +1,90 @@
+package randomizer
+
+import (
+	"context"
+	"testing"
+)
+
+func TestSpheresKeys(t *testing.T) {
+	for _, tc := range []struct {
+		slot, key string
+		spheres   int
+	}{
+		{"d1 stalfos drop", "d1 small key", 1},
+		{"maku tree", "d1 small key", 2},
+		{"d6 present RNG chest", "d6 boss key", 1}, // vanilla ages
+		{"d6 past stalfos chest", "d6 boss key", 1},
+		{"d5 owl chest", "d6 boss key", 2},
+	} {
+		g := newGraph()
+		g["start"] = newNode("start", andNode)
+		keySlot := newNode(tc.slot, andNode)
+		key := newNode(tc.key, orNode)
+		doorSlot := newNode("d1 railway chest", andNode)
+		sword := newNode("sword", orNode)
+		keySlot.addParent(g["start"])
+		doorSlot.addParent(key)
+		for _, n := range []*node{keySlot, key, doorSlot, sword} {
+			g[n.name] = n
+		}
+		checks := map[*node]*node{keySlot: key, doorSlot: sword}
+		key.addParent(keySlot)
+		sword.addParent(doorSlot)
+
+		// keys in their own dungeon don't delimit spheres, but others do
+		spheres, extra := getSpheres(g, checks)
+		if len(spheres) != tc.spheres || len(extra) != 0 {
+			t.Errorf("%s in %s: got %d spheres, want %d",
+				tc.key, tc.slot, len(spheres), tc.spheres)
+		}
+	}
+}
+
+func TestPlaythrough(t *testing.T) {
+	logf := func(string, ...interface{}) {}
+
+	for _, game := range []int{gameSeasons, gameAges} {
+		rom := newRomState(nil, game)
+		ri, err := findRoute(context.Background(), rom, 0x1234,
+			randomizerOptions{}, false, logf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checks := getChecks(ri.usedItems, ri.usedSlots)
+		playthrough := getPlaythrough(ri.graph, checks, rom.treasures)
+
+		// the seed should be beatable with only the playthrough checks, but
+		// not without any one of them.
+		required := make(map[*node]bool)
+		for _, sphere := range playthrough {
+			for _, slot := range sphere {
+				required[slot] = true
+			}
+		}
+		if len(required) == 0 || len(required) == len(checks) {
+			t.Fatalf("%s: %d of %d checks in playthrough",
+				gameNames[game], len(required), len(checks))
+		}
+		for slot, item := range checks {
+			if !required[slot] {
+				item.removeParent(slot)
+			}
+		}
+		ri.graph.reset()
+		ri.graph["start"].explore()
+		if !ri.graph["done"].reached {
+			t.Errorf("%s: playthrough doesn't beat the seed", gameNames[game])
+		}
+		for slot := range required {
+			item := checks[slot]
+			item.removeParent(slot)
+			ri.graph.reset()
+			ri.graph["start"].explore()
+			if ri.graph["done"].reached {
+				t.Errorf("%s: %s not needed for playthrough",
+					gameNames[game], slot.name)
+			}
+			item.addParent(slot)
+		}
+	}
+}
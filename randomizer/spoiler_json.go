@@ -0,0 +1,224 @@
+package randomizer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// version of the json spoiler log format. increment this when making a change
+// that could break existing readers; adding fields doesn't count.
+const jsonSpoilerVersion = 1
+
+// a name as used internally and in the text spoiler log.
+type jsonName struct {
+	Name string `json:"name"`
+	Nice string `json:"nice"`
+}
+
+func newJSONName(name string, game int) jsonName {
+	return jsonName{Name: name, Nice: getNiceName(name, game)}
+}
+
+// an item placed in a slot. category is "progression", "key", or "other".
+type jsonPlacement struct {
+	Slot     jsonName `json:"slot"`
+	Item     jsonName `json:"item"`
+	Category string   `json:"category"`
+}
+
+// a connection from one place to another, like a dungeon entrance or portal.
+type jsonLink struct {
+	From jsonName `json:"from"`
+	To   jsonName `json:"to"`
+}
+
+type jsonSettings struct {
+	Treewarp  bool     `json:"treewarp"`
+	Hard      bool     `json:"hard"`
+	Dungeons  bool     `json:"dungeons"`
+	Portals   bool     `json:"portals"`
+	Essences  int      `json:"essences"`
+	BossOnly  bool     `json:"bossOnly"`
+	Fill      string   `json:"fill"`
+	Keys      string   `json:"keys"`
+	Maps      string   `json:"maps"`
+	Starting  []string `json:"starting"`
+	Excluded  []string `json:"excluded"`
+	Tricks    []string `json:"tricks"`
+	Overlay   string   `json:"logicOverlaySHA1,omitempty"`
+	Asm       []string `json:"asm,omitempty"`
+	Rules     bool     `json:"rules"`
+	Hints     bool     `json:"hints"`
+	HintMix   string   `json:"hintMix,omitempty"`
+	OptString string   `json:"optString"`
+	String    string   `json:"settingsString,omitempty"`
+}
+
+type jsonSpoiler struct {
+	Version   int          `json:"version"`
+	Generator string       `json:"generator"`
+	Game      string       `json:"game"`
+	Seed      string       `json:"seed"`
+	SHA1      string       `json:"sha1"`
+	Settings  jsonSettings `json:"settings"`
+
+	Starting     []jsonName        `json:"starting"`
+	Excluded     []jsonName        `json:"excluded"`
+	Tricks       []string          `json:"requiredTricks"`
+	Spheres      [][]jsonPlacement `json:"spheres"`
+	Inaccessible []jsonPlacement   `json:"inaccessible"`
+	Playthrough  [][]jsonPlacement `json:"playthrough,omitempty"`
+
+	Entrances []jsonLink        `json:"dungeonEntrances"`
+	Portals   []jsonLink        `json:"portals"`
+	Seasons   map[string]string `json:"defaultSeasons,omitempty"`
+	Companion string            `json:"companion"`
+	RingMap   []jsonLink        `json:"ringMap"`
+	Hints     map[string]string `json:"hints"`
+}
+
+// writes a machine-readable version of the spoiler log, containing the same
+// information as writeSummary and then some.
+func writeJSONSummary(w io.Writer, checksum []byte, ropts randomizerOptions,
+	rom *romState, ri *routeInfo, checks map[*node]*node, spheres [][]*node,
+	extra []*node, owlHints map[string]string, playthrough [][]*node) error {
+	game := rom.game
+	nonKeyChecks := make(map[*node]*node)
+	for slot, item := range checks {
+		if !keyRegexp.MatchString(item.name) {
+			nonKeyChecks[slot] = item
+		}
+	}
+	prog, _ := filterJunk(ri.graph, nonKeyChecks, rom.treasures)
+
+	spoiler := &jsonSpoiler{
+		Version:   jsonSpoilerVersion,
+		Generator: "oracles randomizer " + version,
+		Game:      gameNames[game],
+		Seed:      fmt.Sprintf("%08x", ri.seed),
+		SHA1:      fmt.Sprintf("%x", checksum),
+		Settings: jsonSettings{
+			Treewarp: ropts.treewarp,
+			Hard:     ropts.hard,
+			Dungeons: ropts.dungeons,
+			Portals:  ropts.portals,
+			Essences: ropts.requiredEssences(),
+			BossOnly: ropts.bossOnly,
+			Fill: ternary(ropts.fill == "",
+				fillForward, ropts.fill).(string),
+			Keys: ternary(ropts.keys == "",
+				keysOwnDungeon, ropts.keys).(string),
+			Maps: ternary(ropts.maps == "",
+				mapsOwnDungeon, ropts.maps).(string),
+			Starting:  append([]string{}, ropts.starting...),
+			Excluded:  append([]string{}, ropts.excluded...),
+			Tricks:    append([]string{}, ropts.tricks...),
+			Overlay:   ropts.overlay.sumString(),
+			Asm:       getAsmPackNames(ropts.asmPacks),
+			Rules:     len(ropts.placement) > 0,
+			Hints:     owlHints != nil,
+			HintMix:   ropts.hintMix,
+			OptString: optString(ri.seed, ropts, "-"),
+			String: ternary(ropts.plan == nil,
+				encodeSettings(game, ri.seed, ropts), "").(string),
+		},
+		Starting:     make([]jsonName, 0, len(ri.starting)),
+		Excluded:     make([]jsonName, 0, len(ropts.excluded)),
+		Tricks:       getRequiredTricks(ri),
+		Spheres:      make([][]jsonPlacement, 0, len(spheres)),
+		Inaccessible: jsonPlacements(checks, prog, extra, game),
+		Entrances:    make([]jsonLink, 0),
+		Portals:      make([]jsonLink, 0),
+		Companion:    []string{"", "ricky", "dimitri", "moosh"}[ri.companion],
+		RingMap:      make([]jsonLink, 0, len(ri.ringMap)),
+		Hints:        make(map[string]string),
+	}
+
+	for _, name := range ri.starting {
+		spoiler.Starting = append(spoiler.Starting, newJSONName(name, game))
+	}
+	for _, name := range ropts.excluded {
+		spoiler.Excluded = append(spoiler.Excluded, newJSONName(name, game))
+	}
+	for _, sphere := range spheres {
+		spoiler.Spheres = append(spoiler.Spheres,
+			jsonPlacements(checks, prog, sphere, game))
+	}
+	for _, sphere := range playthrough {
+		spoiler.Playthrough = append(spoiler.Playthrough,
+			jsonPlacements(checks, prog, sphere, game))
+	}
+
+	if ropts.dungeons {
+		for _, entrance := range orderedKeys(ri.entrances) {
+			spoiler.Entrances = append(spoiler.Entrances, jsonLink{
+				From: newJSONName(entrance+" entrance", game),
+				To:   newJSONName(ri.entrances[entrance], game),
+			})
+		}
+	}
+	if ropts.portals {
+		for _, portal := range orderedKeys(ri.portals) {
+			spoiler.Portals = append(spoiler.Portals, jsonLink{
+				From: newJSONName(portal, game),
+				To:   newJSONName(ri.portals[portal], game),
+			})
+		}
+	}
+	if game == gameSeasons {
+		spoiler.Seasons = make(map[string]string)
+		for area, id := range ri.seasons {
+			spoiler.Seasons[area] = seasonsById[id]
+		}
+	}
+	for _, vanilla := range orderedKeys(ri.ringMap) {
+		spoiler.RingMap = append(spoiler.RingMap, jsonLink{
+			From: newJSONName(vanilla, game),
+			To:   newJSONName(ri.ringMap[vanilla], game),
+		})
+	}
+	for owlName, hint := range owlHints {
+		oneLineHint := strings.ReplaceAll(hint, "\n", " ")
+		spoiler.Hints[owlName] = strings.ReplaceAll(oneLineHint, "  ", " ")
+	}
+
+	b, err := json.MarshalIndent(spoiler, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
+
+// returns the placements for the slots in a sphere, sorted by slot name.
+func jsonPlacements(checks, prog map[*node]*node, sphere []*node,
+	game int) []jsonPlacement {
+	placements := make([]jsonPlacement, 0)
+	for _, slot := range sphere {
+		item := checks[slot]
+		if item == nil {
+			continue
+		}
+
+		category := "other"
+		if keyRegexp.MatchString(item.name) {
+			category = "key"
+		} else if prog[slot] != nil {
+			category = "progression"
+		}
+
+		placements = append(placements, jsonPlacement{
+			Slot:     newJSONName(slot.name, game),
+			Item:     newJSONName(item.name, game),
+			Category: category,
+		})
+	}
+
+	sort.Slice(placements, func(i, j int) bool {
+		return placements[i].Slot.Name < placements[j].Slot.Name
+	})
+	return placements
+}
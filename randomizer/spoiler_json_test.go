@@ -0,0 +1,59 @@
+package randomizer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+func TestJSONSummary(t *testing.T) {
+	logf := func(string, ...interface{}) {}
+
+	for _, game := range []int{gameSeasons, gameAges} {
+		rom := newRomState(nil, game)
+		ropts := randomizerOptions{dungeons: true}
+		ri, err := findRoute(
+			context.Background(), rom, 0x1234, ropts, false, logf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checks := getChecks(ri.usedItems, ri.usedSlots)
+		spheres, extra := getSpheres(ri.graph, checks)
+
+		b := new(bytes.Buffer)
+		if err := writeJSONSummary(b, nil, ropts, rom, ri, checks, spheres,
+			extra, nil, nil); err != nil {
+			t.Fatal(err)
+		}
+
+		var spoiler jsonSpoiler
+		if err := json.Unmarshal(b.Bytes(), &spoiler); err != nil {
+			t.Fatal(err)
+		}
+		if spoiler.Version != jsonSpoilerVersion {
+			t.Errorf("%s: version %d", gameNames[game], spoiler.Version)
+		}
+		if spoiler.Seed != "00001234" {
+			t.Errorf("%s: seed %s", gameNames[game], spoiler.Seed)
+		}
+
+		n := len(spoiler.Inaccessible)
+		for _, sphere := range spoiler.Spheres {
+			for _, p := range sphere {
+				if checks[ri.graph[p.Slot.Name]] != ri.graph[p.Item.Name] {
+					t.Errorf("%s: bad placement %s <- %s", gameNames[game],
+						p.Slot.Name, p.Item.Name)
+				}
+				n++
+			}
+		}
+		if n != len(checks) {
+			t.Errorf("%s: %d placements in log, but %d checks",
+				gameNames[game], n, len(checks))
+		}
+		if len(spoiler.Entrances) == 0 {
+			t.Errorf("%s: no dungeon entrances in log", gameNames[game])
+		}
+	}
+}
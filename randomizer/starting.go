@@ -0,0 +1,80 @@
+package randomizer
+
+import (
+	"fmt"
+	"strings"
+)
+
+// the most items that link can start with. this determines the size of the
+// table in the ROM.
+const maxStartingItems = 16
+
+// starting items are replaced in the item pool by this.
+const startingItemFiller = "gasha seed"
+
+// returns an error if any of the starting items can't be given in the game.
+func validateStartingItems(names []string, game int) error {
+	if len(names) > maxStartingItems {
+		return fmt.Errorf("too many starting items (max %d)", maxStartingItems)
+	}
+
+	treasures := loadTreasures(nil, game)
+	for _, name := range names {
+		name = ungetNiceName(name, game)
+		if getStringIndex(rings, name) == -1 && treasures[name] == nil {
+			return fmt.Errorf("no such starting item: %s", name)
+		}
+	}
+
+	return nil
+}
+
+// replaces starting items in a list of item names with filler, since they
+// don't need to be placed. items with their own dummy slots are left alone.
+func removeStartingItems(itemNames, starting []string) {
+	for _, name := range starting {
+		switch name {
+		case "bombs, 10", "wooden shield":
+			continue
+		}
+		if i := getStringIndex(itemNames, name); i != -1 {
+			itemNames[i] = startingItemFiller
+		}
+	}
+}
+
+// connects starting items that exist in the graph to the start node.
+func linkStartingItems(g graph, starting []string) {
+	for _, name := range starting {
+		if n := g[name]; n != nil {
+			n.addParent(g["start"])
+		}
+	}
+}
+
+// returns a byte table of (id, subid) entries for the starting items, padded
+// with $ff to the maximum size. rings are given by param instead of subid.
+func makeStartingItemTable(treasures map[string]*treasure,
+	names []string) string {
+	b := new(strings.Builder)
+
+	for _, name := range names {
+		if param := getStringIndex(rings, name); param != -1 {
+			b.Write([]byte{0x2d, byte(param)})
+		} else {
+			t := treasures[name]
+			b.Write([]byte{t.id, t.subid})
+		}
+	}
+
+	for b.Len() < maxStartingItems*2+1 {
+		b.WriteByte(0xff)
+	}
+	return b.String()
+}
+
+// sets the items that link starts the game with.
+func (rom *romState) setStartingItems(names []string) {
+	rom.codeMutables["startingItems"].new =
+		[]byte(makeStartingItemTable(rom.treasures, names))
+}
@@ -1,6 +1,7 @@
 package randomizer
 
 import (
+	"context"
 	"fmt"
 	"math/rand"
 	"os"
@@ -25,7 +26,7 @@ func generateSeeds(n, game int, ropts randomizerOptions) []*routeInfo {
 					// created for each iteration.
 					seed := uint32(rand.Int())
 					rom := newRomState(nil, game)
-					route, _ := findRoute(rom, seed, ropts, false, dummyLogf)
+					route, _ := findRoute(context.Background(), rom, seed, ropts, false, dummyLogf)
 					if route != nil {
 						attempts += route.attemptCount
 						routeChan <- route
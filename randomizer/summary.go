@@ -2,26 +2,20 @@ package randomizer
 
 import (
 	"fmt"
-	"os"
+	"io"
 	"sort"
 	"strings"
 	"time"
 )
 
-// returns a channel that will write strings to a text file with CRLF line
+// returns a channel that will write strings to a writer with CRLF line
 // endings. the function will send on the int channel when finished printing.
-func getSummaryChannel(filename string) (chan string, chan int) {
+func getSummaryChannel(w io.Writer) (chan string, chan int) {
 	c, done := make(chan string), make(chan int)
 
 	go func() {
-		logFile, err := os.Create(filename)
-		if err != nil {
-			panic(err)
-		}
-		defer logFile.Close()
-
 		for line := range c {
-			fmt.Fprintf(logFile, "%s\r\n", line)
+			fmt.Fprintf(w, "%s\r\n", line)
 		}
 		done <- 1
 	}()
@@ -152,19 +146,66 @@ func spheresToText(spheres [][]*node, checks map[*node]*node, except *node) stri
 	return b.String()
 }
 
-// write a "spoiler log" to a file.
-func writeSummary(path string, checksum []byte, ropts randomizerOptions,
+// write a "spoiler log" to a writer.
+func writeSummary(w io.Writer, checksum []byte, ropts randomizerOptions,
 	rom *romState, ri *routeInfo, checks map[*node]*node, spheres [][]*node,
-	extra []*node, owlHints map[string]string) {
-	summary, summaryDone := getSummaryChannel(path)
+	extra []*node, owlHints map[string]string, playthrough [][]*node) {
+	summary, summaryDone := getSummaryChannel(w)
 
 	// header
 	summary <- fmt.Sprintf("seed: %08x", ri.seed)
 	summary <- fmt.Sprintf("sha-1 sum: %x", checksum)
+	if ropts.plan == nil {
+		summary <- fmt.Sprintf("settings: %s",
+			encodeSettings(rom.game, ri.seed, ropts))
+	}
 	summary <- fmt.Sprintf("difficulty: %s",
 		ternary(ropts.hard, "hard", "normal"))
+	if len(ropts.tricks) > 0 && !ropts.hard {
+		summary <- fmt.Sprintf("tricks: %s", strings.Join(ropts.tricks, ", "))
+	}
+	if ropts.overlay != nil {
+		summary <- fmt.Sprintf("logic overlay: %s (sha-1 sum %s)",
+			ropts.overlay.filename, ropts.overlay.sumString())
+	}
+	if len(ropts.asmPacks) > 0 {
+		summary <- fmt.Sprintf("asm files: %s", strings.Join(
+			getAsmPackNames(ropts.asmPacks), ", "))
+	}
+	if len(ri.tricks) > 0 {
+		requiredTricks := getRequiredTricks(ri)
+		summary <- fmt.Sprintf("required tricks: %s", ternary(
+			len(requiredTricks) > 0, strings.Join(requiredTricks, ", "),
+			"none"))
+	}
+	if ropts.bossOnly {
+		summary <- "goal: final boss only"
+	} else if n := ropts.requiredEssences(); n < 8 {
+		summary <- fmt.Sprintf("essences required: %d", n)
+	}
+	if ropts.keys == keysAnyDungeon || ropts.keys == keysAnywhere {
+		summary <- fmt.Sprintf("keysanity: %s", ropts.keys)
+	}
+	if ropts.maps == mapsAnywhere || ropts.maps == mapsVanilla {
+		summary <- fmt.Sprintf("maps and compasses: %s", ropts.maps)
+	}
 
 	// items
+	if len(ri.starting) > 0 {
+		sendSectionHeader(summary, "starting items")
+		for _, name := range ri.starting {
+			summary <- getNiceName(name, rom.game)
+		}
+	}
+	if len(ropts.excluded) > 0 {
+		sendSectionHeader(summary, "excluded locations")
+		sendSorted(summary, func(c chan string) {
+			for _, name := range ropts.excluded {
+				c <- getNiceName(name, rom.game)
+			}
+			close(c)
+		})
+	}
 	sendSectionHeader(summary, "progression items")
 	nonKeyChecks := make(map[*node]*node)
 	for slot, item := range checks {
@@ -178,6 +219,10 @@ func writeSummary(path string, checksum []byte, ropts randomizerOptions,
 	logSpheres(summary, checks, spheres, extra, rom.game, keyRegexp.MatchString)
 	sendSectionHeader(summary, "other items")
 	logSpheres(summary, junk, spheres, extra, rom.game, nil)
+	if playthrough != nil {
+		sendSectionHeader(summary, "playthrough")
+		logSpheres(summary, checks, playthrough, nil, rom.game, nil)
+	}
 
 	// warps
 	if ropts.dungeons {
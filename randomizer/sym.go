@@ -0,0 +1,42 @@
+package randomizer
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// implements the -sym option, which writes a symbol file for the randomized
+// ROM in the format used by BGB and mGBA, so that the randomizer's code can be
+// debugged by name.
+
+// returns the contents of a .sym file for the ROM's labeled code and data,
+// sorted by address. generated labels for anonymous replacements are omitted,
+// since they aren't valid symbols.
+func (rom *romState) getSymbols() []byte {
+	type symbol struct {
+		addr  address
+		label string
+	}
+	symbols := make([]symbol, 0, len(rom.codeMutables))
+	for label, mut := range rom.codeMutables {
+		if !strings.ContainsAny(label, " \t") {
+			symbols = append(symbols, symbol{mut.addr, label})
+		}
+	}
+	sort.Slice(symbols, func(i, j int) bool {
+		a, b := symbols[i], symbols[j]
+		if a.addr != b.addr {
+			return a.addr.fullOffset() < b.addr.fullOffset()
+		}
+		return a.label < b.label
+	})
+
+	b := new(strings.Builder)
+	b.WriteString("; generated by oracles-randomizer " + version + "\n")
+	for _, sym := range symbols {
+		fmt.Fprintf(b, "%02x:%04x %s\n",
+			sym.addr.bank, sym.addr.offset, sym.label)
+	}
+	return []byte(b.String())
+}
@@ -0,0 +1,38 @@
+package randomizer
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestGetSymbols(t *testing.T) {
+	rom := newRomState(nil, gameSeasons)
+	lines := strings.Split(strings.TrimSpace(string(rom.getSymbols())), "\n")
+	if !strings.HasPrefix(lines[0], ";") {
+		t.Errorf("missing header comment: %q", lines[0])
+	}
+
+	found, prev := false, ""
+	for _, line := range lines[1:] {
+		tokens := strings.Split(line, " ")
+		if len(tokens) != 2 {
+			t.Fatalf("malformed line: %q", line)
+		}
+		if tokens[0] < prev {
+			t.Errorf("%q is out of order", line)
+		}
+		prev = tokens[0]
+
+		if mut := rom.codeMutables[tokens[1]]; mut == nil {
+			t.Errorf("unknown label: %s", tokens[1])
+		} else if addr := fmt.Sprintf("%02x:%04x",
+			mut.addr.bank, mut.addr.offset); addr != tokens[0] {
+			t.Errorf("wrong address for %s: %s", tokens[1], tokens[0])
+		}
+		found = found || tokens[1] == "treeWarp"
+	}
+	if !found {
+		t.Error("treeWarp not in symbols")
+	}
+}
@@ -92,7 +92,7 @@ func getTreasureAddr(b []byte, game int, id, subid byte) address {
 func loadTreasures(b []byte, game int) map[string]*treasure {
 	allRawIds := make(map[string]map[string]uint16)
 	if err := yaml.Unmarshal(
-		FSMustByte(false, "/romdata/treasures.yaml"), allRawIds); err != nil {
+		mustReadData("/romdata/treasures.yaml"), allRawIds); err != nil {
 		panic(err)
 	}
 
@@ -0,0 +1,82 @@
+package randomizer
+
+import (
+	"fmt"
+	"sort"
+
+	"gopkg.in/yaml.v2"
+)
+
+// tricks are named advanced techniques that the logic can require. they're
+// declared with descriptions in logic/tricks.yaml, and each is a parentless
+// node in the logic files that's linked to start if the trick is enabled. the
+// hard option enables every trick.
+var trickDescriptions map[string]map[string]string
+
+func init() {
+	loadTrickDescriptions()
+}
+
+// loads the names and descriptions of tricks.
+func loadTrickDescriptions() {
+	trickDescriptions = nil
+	err := yaml.Unmarshal(mustReadData("/logic/tricks.yaml"),
+		&trickDescriptions)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// returns the names of the tricks for a game, in alphabetical order.
+func getTricks(game int) []string {
+	names := make([]string, 0, len(trickDescriptions[gameNames[game]]))
+	for name := range trickDescriptions[gameNames[game]] {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// returns an error if any of the trick names aren't tricks in the game.
+func validateTricks(game int, names []string) error {
+	for _, name := range names {
+		if trickDescriptions[gameNames[game]][name] == "" {
+			return fmt.Errorf("no such trick for %s: %s", gameNames[game], name)
+		}
+	}
+	return nil
+}
+
+// returns the names of the tricks that the options enable.
+func (ropts randomizerOptions) enabledTricks(game int) []string {
+	if ropts.hard {
+		return getTricks(game)
+	}
+	return ropts.tricks
+}
+
+// links the nodes for the named tricks to start.
+func linkTricks(g graph, names []string) {
+	for _, name := range names {
+		g[name].addParent(g["start"])
+	}
+}
+
+// returns the enabled tricks that the route's seed can't be beaten without,
+// in alphabetical order. a trick counts as required if unlinking it alone
+// makes the seed unbeatable.
+func getRequiredTricks(ri *routeInfo) []string {
+	required := make([]string, 0)
+	g := ri.graph
+	for _, name := range ri.tricks {
+		g[name].removeParent(g["start"])
+		g.reset()
+		g["start"].explore()
+		if !g["done"].reached {
+			required = append(required, name)
+		}
+		g[name].addParent(g["start"])
+	}
+	sort.Strings(required)
+	return required
+}
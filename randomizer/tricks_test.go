@@ -0,0 +1,43 @@
+package randomizer
+
+import (
+	"context"
+	"testing"
+)
+
+func TestTricks(t *testing.T) {
+	for _, game := range []int{gameSeasons, gameAges} {
+		if err := validateTricks(game, getTricks(game)); err != nil {
+			t.Error(err)
+		}
+	}
+	if err := validateTricks(gameAges, []string{"cape jump 6"}); err == nil {
+		t.Error("seasons-only trick accepted for ages")
+	}
+
+	ropts := randomizerOptions{tricks: []string{"shovel rupees"}}
+	if tricks := ropts.enabledTricks(gameSeasons); len(tricks) != 1 {
+		t.Errorf("wrong enabled tricks: %v", tricks)
+	}
+	ropts.hard = true
+	if tricks := ropts.enabledTricks(gameSeasons); len(tricks) !=
+		len(getTricks(gameSeasons)) {
+		t.Errorf("hard didn't enable all tricks: %v", tricks)
+	}
+
+	// required tricks are a subset of the enabled ones, and the seed can't be
+	// beaten without any one of them.
+	ri, err := findRoute(context.Background(), newRomState(nil, gameSeasons),
+		0x1234, ropts, false, func(string, ...interface{}) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range getRequiredTricks(ri) {
+		if getStringIndex(ri.tricks, name) == -1 {
+			t.Errorf("required trick %q isn't enabled", name)
+		}
+	}
+	if !ri.graph["done"].reached {
+		t.Error("graph changed by getRequiredTricks")
+	}
+}